@@ -3,10 +3,13 @@ package configparse
 import (
 	"github.com/Unknwon/goconfig"
 	"strconv"
+	"sync"
 )
 
 type Conf struct {
-	items map[string]map[string]string
+	lock     sync.RWMutex
+	filename string
+	items    map[string]map[string]string
 }
 
 var GlobalConf Conf
@@ -14,34 +17,77 @@ var GlobalConf Conf
 var cfg *goconfig.ConfigFile
 
 func (c *Conf) CfgInit(filename string) {
-	c.items = make(map[string]map[string]string)
-	secvalue := make(map[string]string)
-	cfg, err := goconfig.LoadConfigFile(filename)
+	items, err := loadConfigFile(filename)
 	if err != nil {
 		panic("load config file failed " + filename)
 	}
+	c.lock.Lock()
+	c.filename = filename
+	c.items = items
+	c.lock.Unlock()
+}
+
+// 重新加载配置文件，加载失败时保留原有配置
+func (c *Conf) Reload() error {
+	c.lock.RLock()
+	filename := c.filename
+	c.lock.RUnlock()
+
+	items, err := loadConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	c.items = items
+	c.lock.Unlock()
+	return nil
+}
+
+func loadConfigFile(filename string) (map[string]map[string]string, error) {
+	items := make(map[string]map[string]string)
+	cfg, err := goconfig.LoadConfigFile(filename)
+	if err != nil {
+		return nil, err
+	}
 	cfgseclist := cfg.GetSectionList()
 	for _, v := range cfgseclist {
+		// 每个section使用独立的map，避免不同section的同名key互相覆盖
+		secvalue := make(map[string]string)
 		keys := cfg.GetKeyList(v)
 		for _, b := range keys {
 			secvalue[b], err = cfg.GetValue(v, b)
 			if err != nil {
-				panic("get key failed")
+				return nil, err
 			}
-			c.items[v] = secvalue
+			items[v] = secvalue
 		}
 	}
+	return items, nil
 }
 
 func (c *Conf) GetStr(section string, seckey string) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return c.items[section][seckey]
 }
 
 func (c *Conf) GetBool(section string, seckey string) bool {
-	return c.items[section][seckey] == "true" || c.items[section][seckey] == "1"
+	value := c.GetStr(section, seckey)
+	return value == "true" || value == "1"
 }
 
 func (c *Conf) GetInt(section string, seckey string) int {
-	intvalue, _ := strconv.Atoi(c.items[section][seckey])
+	intvalue, _ := strconv.Atoi(c.GetStr(section, seckey))
 	return intvalue
 }
+
+// 获取整个section的配置，返回副本
+func (c *Conf) GetSection(section string) map[string]string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	secvalue := make(map[string]string)
+	for k, v := range c.items[section] {
+		secvalue[k] = v
+	}
+	return secvalue
+}
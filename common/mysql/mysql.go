@@ -152,3 +152,36 @@ func (m *MySQLUtil) SimpleInsert(sql string, args ...interface{}) error {
 	}
 	return nil
 }
+
+// 执行单条写入语句，返回执行结果
+func (m *MySQLUtil) SimpleExec(query string, args ...interface{}) (sql.Result, error) {
+	if m.initialized == false {
+		log.Errorln("[mysql] MySQL 还未初始化， 执行失败")
+		return nil, se.DBError()
+	}
+
+	tx := m.GetTx()
+	if tx == nil {
+		return nil, se.New("tx is nil")
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		log.Errorf("[mysql] MySQL SimpleExec prepare错误, %v", err.Error())
+		tx.Rollback()
+		return nil, se.DBError()
+	}
+	result, err := stmt.Exec(args...)
+	if err != nil {
+		log.Errorf("[mysql] MySQL SimpleExec exec错误, %v", err.Error())
+		stmt.Close()
+		tx.Rollback()
+		return nil, se.DBError()
+	}
+	stmt.Close()
+	err = tx.Commit()
+	if err != nil {
+		log.Errorf("[mysql] MySQL SimpleExec commit错误, %v", err.Error())
+		return nil, se.DBError()
+	}
+	return result, nil
+}
@@ -1,9 +1,18 @@
 package common
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+)
 
 const TIME_FORMAT = "2006-01-02 15:04:05"
 
+const (
+	IP_FAMILY_V4 = "ipv4"
+	IP_FAMILY_V6 = "ipv6"
+)
+
 func GenIntFromType(data []byte) uint64 {
 	return uint64(binary.BigEndian.Uint32(data[:]))
 }
@@ -56,3 +65,53 @@ func Int64SliceEqual(a []int64, b []int64) bool {
 
 	return true
 }
+
+// 从 host:port 格式的地址中解析IP，支持IPv4和IPv6([::1]:8000)
+func HostIpFromAddr(addr string) (string, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if IpFamily(host) == "" {
+		return "", &net.AddrError{Err: "invalid IP address", Addr: addr}
+	}
+	return NormalizeIp(host), nil
+}
+
+// 解析IP，去掉IPv6的zone信息，如 fe80::1%eth0，不合法时返回nil
+func ParseIp(ip string) net.IP {
+	if idx := strings.LastIndex(ip, "%"); idx >= 0 {
+		ip = ip[:idx]
+	}
+	return net.ParseIP(ip)
+}
+
+// 统一IP的格式，IPv4映射的IPv6地址(::ffff:1.2.3.4)转换为IPv4，IPv6使用压缩格式
+func NormalizeIp(ip string) string {
+	ip = strings.TrimSpace(ip)
+	// 去掉IPv6的zone信息，如 fe80::1%eth0
+	host := ip
+	if idx := strings.LastIndex(ip, "%"); idx >= 0 {
+		host = ip[:idx]
+	}
+	parsed := net.ParseIP(host)
+	if parsed == nil {
+		return ip
+	}
+	if host != ip {
+		return parsed.String() + ip[len(host):]
+	}
+	return parsed.String()
+}
+
+// 获取IP的地址族，无法解析时返回空
+func IpFamily(ip string) string {
+	parsed := ParseIp(ip)
+	if parsed == nil {
+		return ""
+	}
+	if parsed.To4() != nil {
+		return IP_FAMILY_V4
+	}
+	return IP_FAMILY_V6
+}
@@ -0,0 +1,105 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestHostIpFromAddr(t *testing.T) {
+	cases := []struct {
+		addr    string
+		ip      string
+		family  string
+		wantErr bool
+	}{
+		{addr: "1.2.3.4:80", ip: "1.2.3.4", family: IP_FAMILY_V4},
+		{addr: "[::1]:80", ip: "::1", family: IP_FAMILY_V6},
+		{addr: "[fe80::1%eth0]:80", ip: "fe80::1%eth0", family: IP_FAMILY_V6},
+		{addr: "[::ffff:1.2.3.4]:80", ip: "1.2.3.4", family: IP_FAMILY_V4},
+		{addr: "[2001:DB8:0:0::1]:80", ip: "2001:db8::1", family: IP_FAMILY_V6},
+		{addr: "1.2.3.4", wantErr: true},
+		{addr: "::1:80", wantErr: true},
+		{addr: "[::1", wantErr: true},
+		{addr: "host:80", wantErr: true},
+		{addr: "1.2.3.256:80", wantErr: true},
+		{addr: "", wantErr: true},
+	}
+
+	for _, c := range cases {
+		ip, err := HostIpFromAddr(c.addr)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("HostIpFromAddr(%q) = %q，期望返回错误", c.addr, ip)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("HostIpFromAddr(%q) 返回错误: %v", c.addr, err)
+			continue
+		}
+		if ip != c.ip {
+			t.Errorf("HostIpFromAddr(%q) = %q，期望 %q", c.addr, ip, c.ip)
+		}
+		if family := IpFamily(ip); family != c.family {
+			t.Errorf("IpFamily(%q) = %q，期望 %q", ip, family, c.family)
+		}
+	}
+}
+
+func TestNormalizeIp(t *testing.T) {
+	cases := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "1.2.3.4", want: "1.2.3.4"},
+		{ip: " 1.2.3.4 ", want: "1.2.3.4"},
+		{ip: "::ffff:1.2.3.4", want: "1.2.3.4"},
+		{ip: "2001:0db8:0000:0000:0000:0000:0000:0001", want: "2001:db8::1"},
+		{ip: "FE80::1%eth0", want: "fe80::1%eth0"},
+		{ip: "not-an-ip", want: "not-an-ip"},
+	}
+
+	for _, c := range cases {
+		if got := NormalizeIp(c.ip); got != c.want {
+			t.Errorf("NormalizeIp(%q) = %q，期望 %q", c.ip, got, c.want)
+		}
+	}
+}
+
+func TestParseIp(t *testing.T) {
+	cases := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "1.2.3.4", want: "1.2.3.4"},
+		{ip: "fe80::1%eth0", want: "fe80::1"},
+		{ip: "::1", want: "::1"},
+		{ip: "1.2.3", want: "<nil>"},
+		{ip: "%eth0", want: "<nil>"},
+	}
+
+	for _, c := range cases {
+		if got := ParseIp(c.ip).String(); got != c.want {
+			t.Errorf("ParseIp(%q) = %q，期望 %q", c.ip, got, c.want)
+		}
+	}
+}
+
+func TestIpFamily(t *testing.T) {
+	cases := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "1.2.3.4", want: IP_FAMILY_V4},
+		{ip: "::ffff:1.2.3.4", want: IP_FAMILY_V4},
+		{ip: "::1", want: IP_FAMILY_V6},
+		{ip: "fe80::1%eth0", want: IP_FAMILY_V6},
+		{ip: "", want: ""},
+		{ip: "1.2.3", want: ""},
+	}
+
+	for _, c := range cases {
+		if got := IpFamily(c.ip); got != c.want {
+			t.Errorf("IpFamily(%q) = %q，期望 %q", c.ip, got, c.want)
+		}
+	}
+}
@@ -25,3 +25,10 @@ func (a *AgentCtrl) GetAgentVersion() (*structs.Version, error) {
 	return a.agentDao.GetAgentVersion()
 }
 
+func (a *AgentCtrl) GetAgentSecret(agentId string) (string, error) {
+	return a.agentDao.GetAgentSecret(agentId)
+}
+
+func (a *AgentCtrl) UpdateAgentIp(agentId string, agentIp string) error {
+	return a.agentDao.UpdateAgentIp(agentId, agentIp)
+}
@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"microserver/dao"
+	"microserver/structs"
+)
+
+var Operationctrl *OperationCtrl
+
+type OperationCtrl struct {
+	operationDao *dao.OperationDAO
+}
+
+func init() {
+	Operationctrl = &OperationCtrl{
+		operationDao: &dao.OperationDAO{},
+	}
+}
+
+func (o *OperationCtrl) AddOperation(op *structs.Operation, agents []*structs.OperationAgent) error {
+	return o.operationDao.AddOperation(op, agents)
+}
+
+func (o *OperationCtrl) GetOperation(opId string) (*structs.Operation, []*structs.OperationAgent, error) {
+	return o.operationDao.GetOperation(opId)
+}
+
+func (o *OperationCtrl) ListOperationIds(limit int) ([]string, error) {
+	return o.operationDao.ListOperationIds(limit)
+}
+
+func (o *OperationCtrl) UpdateOperationAgent(agent *structs.OperationAgent) error {
+	return o.operationDao.UpdateOperationAgent(agent)
+}
+
+func (o *OperationCtrl) PurgeOperations(before string) (int64, error) {
+	return o.operationDao.PurgeOperations(before)
+}
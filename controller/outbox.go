@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"microserver/dao"
+	"microserver/structs"
+)
+
+var Outboxctrl *OutboxCtrl
+
+type OutboxCtrl struct {
+	outboxDao *dao.OutboxDAO
+}
+
+func init() {
+	Outboxctrl = &OutboxCtrl{
+		outboxDao: &dao.OutboxDAO{},
+	}
+}
+
+func (o *OutboxCtrl) AddOutboxItem(item *structs.OutboxItem) (int64, error) {
+	return o.outboxDao.AddOutboxItem(item)
+}
+
+func (o *OutboxCtrl) RestoreOutboxItem(item *structs.OutboxItem) error {
+	return o.outboxDao.RestoreOutboxItem(item)
+}
+
+func (o *OutboxCtrl) ListOutboxItems(agentId string, now string) ([]*structs.OutboxItem, error) {
+	return o.outboxDao.ListOutboxItems(agentId, now)
+}
+
+func (o *OutboxCtrl) CountOutboxItems(agentId string, now string) (int64, error) {
+	return o.outboxDao.CountOutboxItems(agentId, now)
+}
+
+func (o *OutboxCtrl) DeleteOutboxItem(agentId string, id int64) (bool, error) {
+	return o.outboxDao.DeleteOutboxItem(agentId, id)
+}
+
+func (o *OutboxCtrl) PurgeExpiredOutboxItems(now string) (int64, error) {
+	return o.outboxDao.PurgeExpiredOutboxItems(now)
+}
@@ -1,12 +1,39 @@
 package dao
 
 import (
+	"fmt"
+	"microserver/common"
 	se "microserver/common/error"
 	log "microserver/common/formatlog"
 	"microserver/common/mysql"
 	"microserver/structs"
 )
 
+/*
+	Agent表，AGENTID 的唯一索引用于 UpdateAgentIp 的 ON DUPLICATE KEY UPDATE:
+	CREATE TABLE AGENT (
+		id      BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		AGENTID VARCHAR(128) NOT NULL,
+		AGENTIP VARCHAR(64),
+		UNIQUE KEY uk_agentid (AGENTID)
+	)
+
+	已有的AGENT表需要迁移，原有记录使用IP作为AGENTID，同一个ID只保留最新的一条:
+	ALTER TABLE AGENT ADD COLUMN AGENTID VARCHAR(128) NOT NULL DEFAULT '' AFTER id;
+	UPDATE AGENT SET AGENTID = AGENTIP WHERE AGENTID = '';
+	DELETE a FROM AGENT a JOIN AGENT b ON a.AGENTID = b.AGENTID AND a.id < b.id;
+	ALTER TABLE AGENT ADD UNIQUE KEY uk_agentid (AGENTID);
+	agent上报的ID与原来的IP不同时，会登记为新的记录，原有记录需要手动清理
+*/
+
+/*
+	Agent认证密钥表:
+	CREATE TABLE AGENTAUTH (
+		AGENTID VARCHAR(128) NOT NULL PRIMARY KEY,
+		SECRET  VARCHAR(256) NOT NULL
+	)
+*/
+
 type AgentDAO struct {
 }
 
@@ -19,7 +46,7 @@ func (d *AgentDAO) ListAgents() ([]*structs.Agent, error) {
 		return nil, se.New("tx is nil")
 	}
 
-	sql := `SELECT id, AGENTIP
+	sql := `SELECT id, AGENTID, AGENTIP
 			FROM AGENT
 			ORDER BY id DESC`
 	stmt, err := tx.Prepare(sql)
@@ -37,7 +64,7 @@ func (d *AgentDAO) ListAgents() ([]*structs.Agent, error) {
 	}
 	for rows.Next() {
 		agent := &structs.Agent{}
-		err := rows.Scan(&agent.Id, &agent.AgentIp)
+		err := rows.Scan(&agent.Id, &agent.AgentId, &agent.AgentIp)
 		if err != nil {
 			log.Errorf("ListAgents错误, sql: %s ,错误信息: %s", sql, err.Error())
 			rows.Close()
@@ -45,6 +72,7 @@ func (d *AgentDAO) ListAgents() ([]*structs.Agent, error) {
 			tx.Rollback()
 			return nil, err
 		} else {
+			agent.IpFamily = common.IpFamily(agent.AgentIp)
 			result = append(result, agent)
 		}
 	}
@@ -96,3 +124,25 @@ func (d *AgentDAO) GetAgentVersion() (*structs.Version, error) {
 
 	return result, nil
 }
+
+// 获取Agent的认证密钥
+func (d *AgentDAO) GetAgentSecret(agentId string) (string, error) {
+	secret := ""
+	sql := `SELECT SECRET FROM AGENTAUTH WHERE AGENTID = ?`
+	cnt, err := mysql.DB.SingleRowQuery(sql, []interface{}{agentId}, &secret)
+	if err != nil {
+		log.Errorf("GetAgentSecret错误, sql: %s ,错误信息: %s", sql, err.Error())
+		return "", err
+	}
+	if cnt == 0 {
+		return "", se.New(fmt.Sprintf("Agent %s 没有配置认证密钥", agentId))
+	}
+	return secret, nil
+}
+
+// 登记Agent当前的IP，Agent不存在时新增
+func (d *AgentDAO) UpdateAgentIp(agentId string, agentIp string) error {
+	sql := `INSERT INTO AGENT (AGENTID, AGENTIP) VALUES (?, ?)
+			ON DUPLICATE KEY UPDATE AGENTIP = VALUES(AGENTIP)`
+	return mysql.DB.SimpleInsert(sql, agentId, common.NormalizeIp(agentIp))
+}
@@ -0,0 +1,187 @@
+package dao
+
+import (
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"microserver/common/mysql"
+	"microserver/structs"
+)
+
+/*
+	广播操作表:
+	CREATE TABLE AGENTOPERATION (
+		id         BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		OPID       VARCHAR(128) NOT NULL,
+		OPTYPE     VARCHAR(32) NOT NULL,
+		CREATETIME DATETIME NOT NULL,
+		UNIQUE KEY uk_opid (OPID),
+		KEY idx_createtime (CREATETIME)
+	)
+
+	agent在操作中的状态表:
+	CREATE TABLE AGENTOPERATIONSTATUS (
+		OPID       VARCHAR(128) NOT NULL,
+		AGENTID    VARCHAR(128) NOT NULL,
+		STATUS     VARCHAR(32) NOT NULL,
+		ERROR      VARCHAR(1024) NOT NULL DEFAULT '',
+		FINAL      TINYINT NOT NULL DEFAULT 0,
+		UPDATETIME DATETIME NOT NULL,
+		PRIMARY KEY (OPID, AGENTID)
+	)
+*/
+
+type OperationDAO struct {
+}
+
+// 新增操作以及所有目标agent的初始状态
+func (d *OperationDAO) AddOperation(op *structs.Operation, agents []*structs.OperationAgent) error {
+	tx := mysql.DB.GetTx()
+	if tx == nil {
+		return se.New("tx is nil")
+	}
+
+	sql := `INSERT INTO AGENTOPERATION (OPID, OPTYPE, CREATETIME) VALUES (?, ?, ?)`
+	if _, err := tx.Exec(sql, op.OperationId, op.OpType, op.CreateTime); err != nil {
+		log.Errorf("AddOperation错误, sql: %s ,错误信息: %s", sql, err.Error())
+		tx.Rollback()
+		return err
+	}
+	sql = `INSERT INTO AGENTOPERATIONSTATUS (OPID, AGENTID, STATUS, ERROR, FINAL, UPDATETIME)
+			VALUES (?, ?, ?, ?, ?, ?)`
+	stmt, err := tx.Prepare(sql)
+	if err != nil {
+		log.Errorf("AddOperation错误, sql: %s ,错误信息: %s", sql, err.Error())
+		tx.Rollback()
+		return err
+	}
+	for _, agent := range agents {
+		if _, err := stmt.Exec(op.OperationId, agent.AgentId, agent.Status, agent.Error, agent.Final, agent.UpdateTime); err != nil {
+			log.Errorf("AddOperation错误, sql: %s ,错误信息: %s", sql, err.Error())
+			stmt.Close()
+			tx.Rollback()
+			return err
+		}
+	}
+	stmt.Close()
+	return tx.Commit()
+}
+
+// 获取操作以及所有agent的状态，操作不存在时返回nil
+func (d *OperationDAO) GetOperation(opId string) (*structs.Operation, []*structs.OperationAgent, error) {
+	op := &structs.Operation{}
+	sql := `SELECT OPID, OPTYPE, CREATETIME FROM AGENTOPERATION WHERE OPID = ?`
+	cnt, err := mysql.DB.SingleRowQuery(sql, []interface{}{opId}, &op.OperationId, &op.OpType, &op.CreateTime)
+	if err != nil {
+		log.Errorf("GetOperation错误, sql: %s ,错误信息: %s", sql, err.Error())
+		return nil, nil, err
+	}
+	if cnt == 0 {
+		return nil, nil, nil
+	}
+
+	agents := []*structs.OperationAgent{}
+	tx := mysql.DB.GetTx()
+	if tx == nil {
+		return nil, nil, se.New("tx is nil")
+	}
+	sql = `SELECT OPID, AGENTID, STATUS, ERROR, FINAL, UPDATETIME
+			FROM AGENTOPERATIONSTATUS
+			WHERE OPID = ?`
+	stmt, err := tx.Prepare(sql)
+	if err != nil {
+		log.Errorf("GetOperation错误, sql: %s ,错误信息: %s", sql, err.Error())
+		tx.Rollback()
+		return nil, nil, err
+	}
+	rows, err := stmt.Query(opId)
+	if err != nil {
+		log.Errorf("GetOperation错误, sql: %s ,错误信息: %s", sql, err.Error())
+		stmt.Close()
+		tx.Rollback()
+		return nil, nil, err
+	}
+	for rows.Next() {
+		agent := &structs.OperationAgent{}
+		err := rows.Scan(&agent.OperationId, &agent.AgentId, &agent.Status, &agent.Error, &agent.Final, &agent.UpdateTime)
+		if err != nil {
+			log.Errorf("GetOperation错误, sql: %s ,错误信息: %s", sql, err.Error())
+			rows.Close()
+			stmt.Close()
+			tx.Rollback()
+			return nil, nil, err
+		} else {
+			agents = append(agents, agent)
+		}
+	}
+	rows.Close()
+	stmt.Close()
+	tx.Commit()
+
+	return op, agents, nil
+}
+
+// 获取最近的操作ID，最新的操作在前
+func (d *OperationDAO) ListOperationIds(limit int) ([]string, error) {
+	result := []string{}
+
+	tx := mysql.DB.GetTx()
+	if tx == nil {
+		return nil, se.New("tx is nil")
+	}
+
+	sql := `SELECT OPID FROM AGENTOPERATION ORDER BY id DESC LIMIT ?`
+	stmt, err := tx.Prepare(sql)
+	if err != nil {
+		log.Errorf("ListOperationIds错误, sql: %s ,错误信息: %s", sql, err.Error())
+		tx.Rollback()
+		return nil, err
+	}
+	rows, err := stmt.Query(limit)
+	if err != nil {
+		log.Errorf("ListOperationIds错误, sql: %s ,错误信息: %s", sql, err.Error())
+		stmt.Close()
+		tx.Rollback()
+		return nil, err
+	}
+	for rows.Next() {
+		opId := ""
+		if err := rows.Scan(&opId); err != nil {
+			log.Errorf("ListOperationIds错误, sql: %s ,错误信息: %s", sql, err.Error())
+			rows.Close()
+			stmt.Close()
+			tx.Rollback()
+			return nil, err
+		} else {
+			result = append(result, opId)
+		}
+	}
+	rows.Close()
+	stmt.Close()
+	tx.Commit()
+
+	return result, nil
+}
+
+// 更新agent在操作中的状态
+func (d *OperationDAO) UpdateOperationAgent(agent *structs.OperationAgent) error {
+	sql := `UPDATE AGENTOPERATIONSTATUS SET STATUS = ?, ERROR = ?, FINAL = ?, UPDATETIME = ?
+			WHERE OPID = ? AND AGENTID = ?`
+	if _, err := mysql.DB.SimpleExec(sql, agent.Status, agent.Error, agent.Final, agent.UpdateTime, agent.OperationId, agent.AgentId); err != nil {
+		log.Errorf("UpdateOperationAgent错误, sql: %s ,错误信息: %s", sql, err.Error())
+		return err
+	}
+	return nil
+}
+
+// 清理创建时间早于before的操作，返回清理的操作数量
+func (d *OperationDAO) PurgeOperations(before string) (int64, error) {
+	sql := `DELETE o, s FROM AGENTOPERATION o
+			LEFT JOIN AGENTOPERATIONSTATUS s ON s.OPID = o.OPID
+			WHERE o.CREATETIME <= ?`
+	result, err := mysql.DB.SimpleExec(sql, before)
+	if err != nil {
+		log.Errorf("PurgeOperations错误, sql: %s ,错误信息: %s", sql, err.Error())
+		return 0, err
+	}
+	return result.RowsAffected()
+}
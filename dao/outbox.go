@@ -0,0 +1,130 @@
+package dao
+
+import (
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"microserver/common/mysql"
+	"microserver/structs"
+)
+
+/*
+	离线消息表:
+	CREATE TABLE AGENTOUTBOX (
+		id         BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		AGENTID    VARCHAR(128) NOT NULL,
+		MSGTYPE    INT UNSIGNED NOT NULL,
+		PAYLOAD    MEDIUMBLOB,
+		CREATETIME DATETIME NOT NULL,
+		EXPIRETIME DATETIME NOT NULL,
+		KEY idx_agentid (AGENTID, id)
+	)
+*/
+
+type OutboxDAO struct {
+}
+
+// 新增离线消息，返回消息ID
+func (d *OutboxDAO) AddOutboxItem(item *structs.OutboxItem) (int64, error) {
+	sql := `INSERT INTO AGENTOUTBOX (AGENTID, MSGTYPE, PAYLOAD, CREATETIME, EXPIRETIME)
+			VALUES (?, ?, ?, ?, ?)`
+	result, err := mysql.DB.SimpleExec(sql, item.AgentId, item.MsgType, item.Payload, item.CreateTime, item.ExpireTime)
+	if err != nil {
+		log.Errorf("AddOutboxItem错误, sql: %s ,错误信息: %s", sql, err.Error())
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// 使用原来的消息ID重新写入离线消息，保持原有的发送顺序
+func (d *OutboxDAO) RestoreOutboxItem(item *structs.OutboxItem) error {
+	sql := `INSERT INTO AGENTOUTBOX (id, AGENTID, MSGTYPE, PAYLOAD, CREATETIME, EXPIRETIME)
+			VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := mysql.DB.SimpleExec(sql, item.Id, item.AgentId, item.MsgType, item.Payload, item.CreateTime, item.ExpireTime); err != nil {
+		log.Errorf("RestoreOutboxItem错误, sql: %s ,错误信息: %s", sql, err.Error())
+		return err
+	}
+	return nil
+}
+
+// 获取agent未过期的离线消息，按写入顺序排列
+func (d *OutboxDAO) ListOutboxItems(agentId string, now string) ([]*structs.OutboxItem, error) {
+	result := []*structs.OutboxItem{}
+
+	tx := mysql.DB.GetTx()
+	if tx == nil {
+		return nil, se.New("tx is nil")
+	}
+
+	sql := `SELECT id, AGENTID, MSGTYPE, PAYLOAD, CREATETIME, EXPIRETIME
+			FROM AGENTOUTBOX
+			WHERE AGENTID = ? AND EXPIRETIME > ?
+			ORDER BY id ASC`
+	stmt, err := tx.Prepare(sql)
+	if err != nil {
+		log.Errorf("ListOutboxItems错误, sql: %s ,错误信息: %s", sql, err.Error())
+		tx.Rollback()
+		return nil, err
+	}
+	rows, err := stmt.Query(agentId, now)
+	if err != nil {
+		log.Errorf("ListOutboxItems错误, sql: %s ,错误信息: %s", sql, err.Error())
+		stmt.Close()
+		tx.Rollback()
+		return nil, err
+	}
+	for rows.Next() {
+		item := &structs.OutboxItem{}
+		err := rows.Scan(&item.Id, &item.AgentId, &item.MsgType, &item.Payload, &item.CreateTime, &item.ExpireTime)
+		if err != nil {
+			log.Errorf("ListOutboxItems错误, sql: %s ,错误信息: %s", sql, err.Error())
+			rows.Close()
+			stmt.Close()
+			tx.Rollback()
+			return nil, err
+		} else {
+			result = append(result, item)
+		}
+	}
+	rows.Close()
+	stmt.Close()
+	tx.Commit()
+
+	return result, nil
+}
+
+// 获取agent未过期的离线消息数量
+func (d *OutboxDAO) CountOutboxItems(agentId string, now string) (int64, error) {
+	var cnt int64
+	sql := `SELECT COUNT(*) FROM AGENTOUTBOX WHERE AGENTID = ? AND EXPIRETIME > ?`
+	if _, err := mysql.DB.SingleRowQuery(sql, []interface{}{agentId, now}, &cnt); err != nil {
+		log.Errorf("CountOutboxItems错误, sql: %s ,错误信息: %s", sql, err.Error())
+		return 0, err
+	}
+	return cnt, nil
+}
+
+// 删除agent的一条离线消息，返回是否删除
+func (d *OutboxDAO) DeleteOutboxItem(agentId string, id int64) (bool, error) {
+	sql := `DELETE FROM AGENTOUTBOX WHERE AGENTID = ? AND id = ?`
+	result, err := mysql.DB.SimpleExec(sql, agentId, id)
+	if err != nil {
+		log.Errorf("DeleteOutboxItem错误, sql: %s ,错误信息: %s", sql, err.Error())
+		return false, err
+	}
+	cnt, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return cnt > 0, nil
+}
+
+// 清理已经过期的离线消息，返回清理的数量
+func (d *OutboxDAO) PurgeExpiredOutboxItems(now string) (int64, error) {
+	sql := `DELETE FROM AGENTOUTBOX WHERE EXPIRETIME <= ?`
+	result, err := mysql.DB.SimpleExec(sql, now)
+	if err != nil {
+		log.Errorf("PurgeExpiredOutboxItems错误, sql: %s ,错误信息: %s", sql, err.Error())
+		return 0, err
+	}
+	return result.RowsAffected()
+}
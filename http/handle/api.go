@@ -2,12 +2,14 @@ package handle
 
 import (
 	"encoding/json"
+	"github.com/gorilla/mux"
 	"io/ioutil"
 	"microserver/common"
 	log "microserver/common/formatlog"
 	"microserver/controller"
 	"microserver/server"
 	"net/http"
+	"strconv"
 )
 
 // 测试API
@@ -109,10 +111,11 @@ func apiGetAgentLastestVersion(res http.ResponseWriter, req *http.Request) {
 
 // 开启全网更新
 func apiBroadCastUpdate(res http.ResponseWriter, req *http.Request) {
-	go server.Ioserver.BroadcastUpdate()
+	opId := server.Ioserver.BroadcastUpdate()
 
 	a := make(map[string]string)
 	a["startupdate"] = "yes"
+	a["operationid"] = opId
 	b, err := json.Marshal(a)
 	if err != nil {
 		log.Errorf("[http] apiBroadCastUpdate JSON生成失败, %v", err.Error())
@@ -121,3 +124,141 @@ func apiBroadCastUpdate(res http.ResponseWriter, req *http.Request) {
 	}
 	common.ResMsg(res, 200, string(b))
 }
+
+// 通知指定agent进行更新，返回每个agent的发送结果
+func apiAgentsUpdate(res http.ResponseWriter, req *http.Request) {
+	type Request struct {
+		Agents []string `json:"agents"`
+	}
+
+	reqContent, err := ioutil.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		log.Errorf("[http] 请求报文解析失败")
+		common.ReqBodyInvalid(res)
+		return
+	}
+
+	request := &Request{}
+	if err := common.ParseJsonStr(string(reqContent), request); err != nil {
+		log.Errorln("[http] 解析模板JSON失败")
+		common.ResMsg(res, 400, err.Error())
+		return
+	}
+	if len(request.Agents) == 0 {
+		common.ResMsg(res, 400, "agents不能为空")
+		return
+	}
+
+	results := server.Ioserver.SendUpdate(request.Agents)
+	b, err := json.Marshal(results)
+	if err != nil {
+		log.Errorf("[http] apiAgentsUpdate JSON生成失败, %v", err.Error())
+		common.ResMsg(res, 400, err.Error())
+		return
+	}
+	common.ResMsg(res, 200, string(b))
+}
+
+// 获取所有在线agent的探测往返时间
+func apiGetAgentsRtt(res http.ResponseWriter, req *http.Request) {
+	b, err := json.Marshal(server.Ioserver.ListAgentPingStats())
+	if err != nil {
+		log.Errorf("[http] apiGetAgentsRtt JSON生成失败, %v", err.Error())
+		common.ResMsg(res, 400, err.Error())
+		return
+	}
+	common.ResMsg(res, 200, string(b))
+}
+
+// 获取指定agent的连接统计
+func apiGetAgentConnection(res http.ResponseWriter, req *http.Request) {
+	agentId := mux.Vars(req)["id"]
+	conns := server.Ioserver.GetAgentConnections(agentId)
+	if len(conns) == 0 {
+		common.ResMsg(res, 404, "agent "+agentId+" 不在线")
+		return
+	}
+	b, err := json.Marshal(conns)
+	if err != nil {
+		log.Errorf("[http] apiGetAgentConnection JSON生成失败, %v", err.Error())
+		common.ResMsg(res, 400, err.Error())
+		return
+	}
+	common.ResMsg(res, 200, string(b))
+}
+
+// 获取所有连接的统计
+func apiListAgentConnections(res http.ResponseWriter, req *http.Request) {
+	b, err := json.Marshal(server.Ioserver.ListConnections())
+	if err != nil {
+		log.Errorf("[http] apiListAgentConnections JSON生成失败, %v", err.Error())
+		common.ResMsg(res, 400, err.Error())
+		return
+	}
+	common.ResMsg(res, 200, string(b))
+}
+
+// 获取指定agent等待发送的离线消息
+func apiGetAgentOutbox(res http.ResponseWriter, req *http.Request) {
+	items, err := server.Ioserver.ListOutbox(mux.Vars(req)["id"])
+	if err != nil {
+		common.ResMsg(res, 500, err.Error())
+		return
+	}
+	b, err := json.Marshal(items)
+	if err != nil {
+		log.Errorf("[http] apiGetAgentOutbox JSON生成失败, %v", err.Error())
+		common.ResMsg(res, 400, err.Error())
+		return
+	}
+	common.ResMsg(res, 200, string(b))
+}
+
+// 取消指定agent的一条离线消息
+func apiCancelAgentOutbox(res http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := strconv.ParseInt(vars["itemid"], 10, 64)
+	if err != nil {
+		common.ResMsg(res, 400, "离线消息ID不合法")
+		return
+	}
+	ok, err := server.Ioserver.CancelOutbox(vars["id"], id)
+	if err != nil {
+		common.ResMsg(res, 500, err.Error())
+		return
+	}
+	if !ok {
+		common.ResMsg(res, 404, "离线消息不存在")
+		return
+	}
+	common.ResMsg(res, 200, "ok")
+}
+
+// 获取所有广播操作的汇总进度
+func apiListOperations(res http.ResponseWriter, req *http.Request) {
+	b, err := json.Marshal(server.Ioserver.ListOperations())
+	if err != nil {
+		log.Errorf("[http] apiListOperations JSON生成失败, %v", err.Error())
+		common.ResMsg(res, 400, err.Error())
+		return
+	}
+	common.ResMsg(res, 200, string(b))
+}
+
+// 获取指定广播操作的进度和每个agent的状态
+func apiGetOperation(res http.ResponseWriter, req *http.Request) {
+	opId := mux.Vars(req)["id"]
+	op, ok := server.Ioserver.GetOperation(opId)
+	if !ok {
+		common.ResMsg(res, 404, "操作 "+opId+" 不存在")
+		return
+	}
+	b, err := json.Marshal(op)
+	if err != nil {
+		log.Errorf("[http] apiGetOperation JSON生成失败, %v", err.Error())
+		common.ResMsg(res, 400, err.Error())
+		return
+	}
+	common.ResMsg(res, 200, string(b))
+}
@@ -2,6 +2,7 @@ package handle
 
 import (
 	"microserver/http"
+	"microserver/server"
 	//go_http "net/http"
 )
 
@@ -9,6 +10,7 @@ func InitHandle(r *http.WWWMux) {
 	// api相关的接口
 	initAPIMapping(r)
 	initPackageMapping(r)
+	initAgentMapping(r)
 }
 
 func initAPIMapping(r *http.WWWMux) {
@@ -20,8 +22,31 @@ func initAPIMapping(r *http.WWWMux) {
 	r.RegistURLMapping("/v1/api/listagentsnum", "GET", apiGetAllAgentsNum)
 	// 获取当前agent的最新版本，用于自动更新
 	r.RegistURLMapping("/v1/api/agentlastversion", "GET", apiGetAgentLastestVersion)	
-	// 发送广播报文，让Agent 开启更新自检
+	// 发送广播报文，让Agent 开启更新自检，返回可追踪的操作ID
 	r.RegistURLMapping("/v1/api/updatebroadcast", "POST", apiBroadCastUpdate)	
+	// 通知指定Agent开启更新自检，返回每个Agent的发送结果
+	r.RegistURLMapping("/v1/api/updateagents", "POST", apiAgentsUpdate)
+	// 获取在线Agent的探测往返时间
+	r.RegistURLMapping("/v1/api/agentsrtt", "GET", apiGetAgentsRtt)
+	// 获取所有连接的统计
+	r.RegistURLMapping("/v1/api/agents/connections", "GET", apiListAgentConnections)
+	// 获取指定Agent的连接统计
+	r.RegistURLMapping("/v1/api/agents/{id}/connection", "GET", apiGetAgentConnection)
+	// 获取指定Agent等待发送的离线消息
+	r.RegistURLMapping("/v1/api/agents/{id}/outbox", "GET", apiGetAgentOutbox)
+	// 取消指定Agent的一条离线消息
+	r.RegistURLMapping("/v1/api/agents/{id}/outbox/{itemid}", "DELETE", apiCancelAgentOutbox)
+	// 获取所有广播操作的进度
+	r.RegistURLMapping("/v1/api/operations", "GET", apiListOperations)
+	// 获取指定广播操作的进度和每个Agent的状态
+	r.RegistURLMapping("/v1/api/operations/{id}", "GET", apiGetOperation)
+}
+
+func initAgentMapping(r *http.WWWMux) {
+	// Agent通过WebSocket接入IO服务
+	if server.WebSocketEnabled() {
+		r.RegistURLMapping(server.WebSocketPath(), "GET", server.Ioserver.ServeWebSocket)
+	}
 }
 
 func initPackageMapping(r *http.WWWMux) {
@@ -2,15 +2,21 @@ package main
 
 import (
 	//"fmt"
+	"context"
 	"math/rand"
 	cfg "microserver/common/configparse"
 	log "microserver/common/formatlog"
 	"microserver/common/mysql"
 	"microserver/http"
 	"microserver/http/handle"
+	"microserver/plugin/collector"
 	"microserver/server"
 	go_http "net/http"
+	"os"
+	"os/signal"
 	"runtime"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -30,9 +36,17 @@ func main() {
 	// 启动IO服务
 	//ioServer := server.NewServer()
 	server.Ioserver.Init()
+
+	// 注册插件，注册失败则直接panic
+	if err := collector.Init(); err != nil {
+		panic(err)
+	}
 	go server.Ioserver.Run()
 
-	// 启动HTTP服务
+	// 启动HTTP服务，HTTP服务没有开启TLS，WebSocket接入不能要求客户端证书
+	if err := server.CheckWebSocketConf(false); err != nil {
+		panic(err)
+	}
 	mux := http.New()
 	handle.InitHandle(mux)
 	srv := &go_http.Server{
@@ -42,8 +56,50 @@ func main() {
 		ReadTimeout:  15 * time.Hour,
 	}
 	log.Infof("[Microserver] HTTP服务启动，监听地址为 %s", cfg.GlobalConf.GetStr("common", "httpsvr"))
-	go srv.ListenAndServe()
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != go_http.ErrServerClosed {
+			log.Errorf("[Microserver] HTTP服务异常退出: %s", err.Error())
+		}
+	}()
+
+	// 等待退出信号，SIGHUP 重新加载配置文件并更新访问规则
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	sig := <-sigCh
+	for sig == syscall.SIGHUP {
+		log.Infoln("[Microserver] 收到SIGHUP信号，重新加载配置")
+		if err := cfg.GlobalConf.Reload(); err != nil {
+			log.Errorf("[Microserver] 配置文件加载失败: %s", err.Error())
+		} else {
+			server.Ioserver.ReloadAccessPolicy()
+		}
+		sig = <-sigCh
+	}
+	log.Infof("[Microserver] 收到信号 %v，开始关闭服务", sig)
+
+	shutdownTimeout := cfg.GlobalConf.GetInt("common", "shutdowntimeout")
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 30
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(shutdownTimeout)*time.Second)
+	defer cancel()
 
-	// 等待
-	select {}
+	// IO服务和HTTP服务同时关闭，各自都有完整的超时时间
+	shutdownWg := &sync.WaitGroup{}
+	shutdownWg.Add(2)
+	go func() {
+		defer shutdownWg.Done()
+		if err := server.Ioserver.Shutdown(ctx); err != nil {
+			log.Errorf("[Microserver] IO服务关闭异常: %s", err.Error())
+		}
+	}()
+	go func() {
+		defer shutdownWg.Done()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Errorf("[Microserver] HTTP服务关闭异常: %s", err.Error())
+		}
+	}()
+	shutdownWg.Wait()
+	mysql.DB.CloseConn()
+	log.Infoln("[Microserver] 服务已关闭")
 }
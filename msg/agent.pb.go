@@ -180,9 +180,10 @@ func (m *Rpms) GetRpmlist() []string {
 	return nil
 }
 
-// 服务端发送更新Agent指令
+// 服务端发送更新Agent指令，operationId不为空时agent需要回复OperationAck
 type UpdateMsg struct {
 	Updateswitch         bool     `protobuf:"varint,1,opt,name=updateswitch,proto3" json:"updateswitch,omitempty"`
+	OperationId          string   `protobuf:"bytes,2,opt,name=operationId,proto3" json:"operationId,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -220,30 +221,492 @@ func (m *UpdateMsg) GetUpdateswitch() bool {
 	return false
 }
 
+func (m *UpdateMsg) GetOperationId() string {
+	if m != nil {
+		return m.OperationId
+	}
+	return ""
+}
+
+// 服务端发起的同步请求，payload为type对应的protobuf报文
+type RpcRequest struct {
+	RequestId            uint64   `protobuf:"varint,1,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	Type                 uint64   `protobuf:"varint,2,opt,name=type,proto3" json:"type,omitempty"`
+	Payload              []byte   `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RpcRequest) Reset()         { *m = RpcRequest{} }
+func (m *RpcRequest) String() string { return proto.CompactTextString(m) }
+func (*RpcRequest) ProtoMessage()    {}
+func (*RpcRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3305a4287f8287e0, []int{4}
+}
+
+func (m *RpcRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RpcRequest.Unmarshal(m, b)
+}
+func (m *RpcRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RpcRequest.Marshal(b, m, deterministic)
+}
+func (m *RpcRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RpcRequest.Merge(m, src)
+}
+func (m *RpcRequest) XXX_Size() int {
+	return xxx_messageInfo_RpcRequest.Size(m)
+}
+func (m *RpcRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RpcRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RpcRequest proto.InternalMessageInfo
+
+func (m *RpcRequest) GetRequestId() uint64 {
+	if m != nil {
+		return m.RequestId
+	}
+	return 0
+}
+
+func (m *RpcRequest) GetType() uint64 {
+	if m != nil {
+		return m.Type
+	}
+	return 0
+}
+
+func (m *RpcRequest) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+// Agent对同步请求的响应，requestId与请求一致
+type RpcResponse struct {
+	RequestId            uint64   `protobuf:"varint,1,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	Type                 uint64   `protobuf:"varint,2,opt,name=type,proto3" json:"type,omitempty"`
+	Payload              []byte   `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Error                string   `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RpcResponse) Reset()         { *m = RpcResponse{} }
+func (m *RpcResponse) String() string { return proto.CompactTextString(m) }
+func (*RpcResponse) ProtoMessage()    {}
+func (*RpcResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3305a4287f8287e0, []int{5}
+}
+
+func (m *RpcResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RpcResponse.Unmarshal(m, b)
+}
+func (m *RpcResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RpcResponse.Marshal(b, m, deterministic)
+}
+func (m *RpcResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RpcResponse.Merge(m, src)
+}
+func (m *RpcResponse) XXX_Size() int {
+	return xxx_messageInfo_RpcResponse.Size(m)
+}
+func (m *RpcResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RpcResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RpcResponse proto.InternalMessageInfo
+
+func (m *RpcResponse) GetRequestId() uint64 {
+	if m != nil {
+		return m.RequestId
+	}
+	return 0
+}
+
+func (m *RpcResponse) GetType() uint64 {
+	if m != nil {
+		return m.Type
+	}
+	return 0
+}
+
+func (m *RpcResponse) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *RpcResponse) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+// Agent连接后发送的第一个认证报文，token和signature二选一
+// agentId 为agent稳定的唯一标识(UUID/主机名)
+// signature = hex(HMAC-SHA256(secret, "agentId:timestamp"))
+// versions/capabilities 为agent支持的协议版本和能力，未携带时按协议版本1处理
+type Auth struct {
+	Token                string   `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Timestamp            int64    `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Signature            string   `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	AgentId              string   `protobuf:"bytes,4,opt,name=agentId,proto3" json:"agentId,omitempty"`
+	Versions             []uint32 `protobuf:"varint,5,rep,packed,name=versions,proto3" json:"versions,omitempty"`
+	Capabilities         []string `protobuf:"bytes,6,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Auth) Reset()         { *m = Auth{} }
+func (m *Auth) String() string { return proto.CompactTextString(m) }
+func (*Auth) ProtoMessage()    {}
+func (*Auth) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3305a4287f8287e0, []int{6}
+}
+
+func (m *Auth) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Auth.Unmarshal(m, b)
+}
+func (m *Auth) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Auth.Marshal(b, m, deterministic)
+}
+func (m *Auth) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Auth.Merge(m, src)
+}
+func (m *Auth) XXX_Size() int {
+	return xxx_messageInfo_Auth.Size(m)
+}
+func (m *Auth) XXX_DiscardUnknown() {
+	xxx_messageInfo_Auth.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Auth proto.InternalMessageInfo
+
+func (m *Auth) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *Auth) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *Auth) GetSignature() string {
+	if m != nil {
+		return m.Signature
+	}
+	return ""
+}
+
+func (m *Auth) GetAgentId() string {
+	if m != nil {
+		return m.AgentId
+	}
+	return ""
+}
+
+func (m *Auth) GetVersions() []uint32 {
+	if m != nil {
+		return m.Versions
+	}
+	return nil
+}
+
+func (m *Auth) GetCapabilities() []string {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
+// 服务端返回的认证结果，以及协商后的协议版本和能力
+// 该报文始终使用协议版本1发送，之后的报文使用协商后的版本
+type AuthResponse struct {
+	Success              bool     `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Reason               string   `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	Version              uint32   `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	Capabilities         []string `protobuf:"bytes,4,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AuthResponse) Reset()         { *m = AuthResponse{} }
+func (m *AuthResponse) String() string { return proto.CompactTextString(m) }
+func (*AuthResponse) ProtoMessage()    {}
+func (*AuthResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3305a4287f8287e0, []int{7}
+}
+
+func (m *AuthResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AuthResponse.Unmarshal(m, b)
+}
+func (m *AuthResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AuthResponse.Marshal(b, m, deterministic)
+}
+func (m *AuthResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AuthResponse.Merge(m, src)
+}
+func (m *AuthResponse) XXX_Size() int {
+	return xxx_messageInfo_AuthResponse.Size(m)
+}
+func (m *AuthResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_AuthResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AuthResponse proto.InternalMessageInfo
+
+func (m *AuthResponse) GetSuccess() bool {
+	if m != nil {
+		return m.Success
+	}
+	return false
+}
+
+func (m *AuthResponse) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+func (m *AuthResponse) GetVersion() uint32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *AuthResponse) GetCapabilities() []string {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
+// 服务端即将关闭，agent应在reconnectAfter秒后重新连接
+type GoAway struct {
+	Reason               string   `protobuf:"bytes,1,opt,name=reason,proto3" json:"reason,omitempty"`
+	ReconnectAfter       int32    `protobuf:"varint,2,opt,name=reconnectAfter,proto3" json:"reconnectAfter,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GoAway) Reset()         { *m = GoAway{} }
+func (m *GoAway) String() string { return proto.CompactTextString(m) }
+func (*GoAway) ProtoMessage()    {}
+func (*GoAway) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3305a4287f8287e0, []int{8}
+}
+
+func (m *GoAway) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GoAway.Unmarshal(m, b)
+}
+func (m *GoAway) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GoAway.Marshal(b, m, deterministic)
+}
+func (m *GoAway) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GoAway.Merge(m, src)
+}
+func (m *GoAway) XXX_Size() int {
+	return xxx_messageInfo_GoAway.Size(m)
+}
+func (m *GoAway) XXX_DiscardUnknown() {
+	xxx_messageInfo_GoAway.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GoAway proto.InternalMessageInfo
+
+func (m *GoAway) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+func (m *GoAway) GetReconnectAfter() int32 {
+	if m != nil {
+		return m.ReconnectAfter
+	}
+	return 0
+}
+
+// 服务端探测报文，agent收到后原样返回Pong
+type Ping struct {
+	Seq                  uint64   `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	SendTime             int64    `protobuf:"varint,2,opt,name=sendTime,proto3" json:"sendTime,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Ping) Reset()         { *m = Ping{} }
+func (m *Ping) String() string { return proto.CompactTextString(m) }
+func (*Ping) ProtoMessage()    {}
+func (*Ping) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3305a4287f8287e0, []int{9}
+}
+
+func (m *Ping) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Ping.Unmarshal(m, b)
+}
+func (m *Ping) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Ping.Marshal(b, m, deterministic)
+}
+func (m *Ping) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Ping.Merge(m, src)
+}
+func (m *Ping) XXX_Size() int {
+	return xxx_messageInfo_Ping.Size(m)
+}
+func (m *Ping) XXX_DiscardUnknown() {
+	xxx_messageInfo_Ping.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Ping proto.InternalMessageInfo
+
+func (m *Ping) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+func (m *Ping) GetSendTime() int64 {
+	if m != nil {
+		return m.SendTime
+	}
+	return 0
+}
+
+// Agent对服务端操作的确认，stage 1为已收到，2为执行完成
+// 执行完成时success表示执行结果，失败原因在error中
+type OperationAck struct {
+	OperationId          string   `protobuf:"bytes,1,opt,name=operationId,proto3" json:"operationId,omitempty"`
+	Stage                uint32   `protobuf:"varint,2,opt,name=stage,proto3" json:"stage,omitempty"`
+	Success              bool     `protobuf:"varint,3,opt,name=success,proto3" json:"success,omitempty"`
+	Error                string   `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *OperationAck) Reset()         { *m = OperationAck{} }
+func (m *OperationAck) String() string { return proto.CompactTextString(m) }
+func (*OperationAck) ProtoMessage()    {}
+func (*OperationAck) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3305a4287f8287e0, []int{10}
+}
+
+func (m *OperationAck) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_OperationAck.Unmarshal(m, b)
+}
+func (m *OperationAck) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_OperationAck.Marshal(b, m, deterministic)
+}
+func (m *OperationAck) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_OperationAck.Merge(m, src)
+}
+func (m *OperationAck) XXX_Size() int {
+	return xxx_messageInfo_OperationAck.Size(m)
+}
+func (m *OperationAck) XXX_DiscardUnknown() {
+	xxx_messageInfo_OperationAck.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_OperationAck proto.InternalMessageInfo
+
+func (m *OperationAck) GetOperationId() string {
+	if m != nil {
+		return m.OperationId
+	}
+	return ""
+}
+
+func (m *OperationAck) GetStage() uint32 {
+	if m != nil {
+		return m.Stage
+	}
+	return 0
+}
+
+func (m *OperationAck) GetSuccess() bool {
+	if m != nil {
+		return m.Success
+	}
+	return false
+}
+
+func (m *OperationAck) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*Heartbeat)(nil), "msg.Heartbeat")
 	proto.RegisterType((*Collect)(nil), "msg.Collect")
 	proto.RegisterType((*Rpms)(nil), "msg.Rpms")
 	proto.RegisterType((*UpdateMsg)(nil), "msg.UpdateMsg")
+	proto.RegisterType((*RpcRequest)(nil), "msg.RpcRequest")
+	proto.RegisterType((*RpcResponse)(nil), "msg.RpcResponse")
+	proto.RegisterType((*Auth)(nil), "msg.Auth")
+	proto.RegisterType((*AuthResponse)(nil), "msg.AuthResponse")
+	proto.RegisterType((*GoAway)(nil), "msg.GoAway")
+	proto.RegisterType((*Ping)(nil), "msg.Ping")
+	proto.RegisterType((*OperationAck)(nil), "msg.OperationAck")
 }
 
 func init() { proto.RegisterFile("protobuf/agent.proto", fileDescriptor_3305a4287f8287e0) }
 
 var fileDescriptor_3305a4287f8287e0 = []byte{
-	// 230 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0xd0, 0xbf, 0x4e, 0x04, 0x21,
-	0x10, 0x06, 0xf0, 0xe0, 0xde, 0xbf, 0x9d, 0x68, 0x43, 0x8c, 0x21, 0x56, 0x1b, 0x62, 0x71, 0x95,
-	0x57, 0xf8, 0x08, 0xd7, 0x68, 0x61, 0x43, 0xf4, 0x01, 0x58, 0xc4, 0xdd, 0x4d, 0xe0, 0x20, 0x30,
-	0xc4, 0x67, 0xf0, 0xad, 0x0d, 0x73, 0x9c, 0xc9, 0x95, 0xbf, 0xe1, 0x9b, 0x2f, 0x13, 0xe0, 0x3e,
-	0xa6, 0x80, 0x61, 0x2c, 0xdf, 0x07, 0x3d, 0xd9, 0x13, 0x3e, 0x13, 0x79, 0xe7, 0xf3, 0x24, 0xdf,
-	0xa0, 0x7f, 0xb5, 0x3a, 0xe1, 0x68, 0x35, 0xf2, 0x07, 0xd8, 0x64, 0xd4, 0x58, 0xb2, 0x60, 0x03,
-	0xdb, 0xf7, 0xaa, 0x89, 0x3f, 0xc1, 0xdd, 0x7c, 0x09, 0x7d, 0x2c, 0xde, 0x8a, 0x1b, 0x7a, 0xbe,
-	0x1e, 0xca, 0x5f, 0x06, 0xdb, 0x63, 0x70, 0xce, 0x1a, 0x6a, 0x2a, 0x11, 0x6b, 0xb4, 0x35, 0x9d,
-	0xc5, 0x05, 0x6c, 0x4d, 0x2c, 0x3a, 0x99, 0xb9, 0x75, 0x5c, 0x58, 0x37, 0x4c, 0x2c, 0xa7, 0xe2,
-	0x45, 0x37, 0xb0, 0xfd, 0x5a, 0x35, 0xf1, 0x47, 0xd8, 0x79, 0xeb, 0x31, 0xa0, 0x76, 0x62, 0x45,
-	0x2b, 0xff, 0xae, 0x6d, 0xc7, 0xe0, 0xe8, 0xa2, 0xf5, 0xb9, 0xad, 0x51, 0x0e, 0xb0, 0x52, 0xd1,
-	0xe7, 0x9a, 0x48, 0xd1, 0xbb, 0x25, 0xa3, 0x60, 0x43, 0x57, 0x13, 0x8d, 0xf2, 0x00, 0xfd, 0x67,
-	0xfc, 0xd2, 0x68, 0xdf, 0xf3, 0xc4, 0x25, 0xdc, 0x16, 0x42, 0xfe, 0x59, 0xd0, 0xcc, 0x74, 0xf4,
-	0x4e, 0x5d, 0xcd, 0xc6, 0x0d, 0xfd, 0xda, 0xcb, 0x5f, 0x00, 0x00, 0x00, 0xff, 0xff, 0xb7, 0x96,
-	0x95, 0xf6, 0x4d, 0x01, 0x00, 0x00,
+	// 529 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x94, 0x4f, 0x6f, 0xd4, 0x3c,
+	0x10, 0xc6, 0x95, 0x37, 0xd9, 0x6d, 0x77, 0xba, 0xfb, 0x0a, 0x59, 0x15, 0x8a, 0x10, 0x87, 0x28,
+	0x42, 0x68, 0x4f, 0x70, 0x80, 0x2f, 0xb0, 0xea, 0x81, 0xee, 0x01, 0x01, 0x16, 0x48, 0x5c, 0xbd,
+	0xce, 0x34, 0x1b, 0x35, 0xb1, 0x5d, 0x7b, 0xd2, 0x6a, 0x2f, 0xdc, 0xf9, 0x3a, 0x7c, 0x42, 0x64,
+	0xc7, 0xd9, 0x3f, 0x6d, 0x8f, 0xdc, 0xfc, 0x1b, 0x8f, 0x9f, 0x19, 0xcd, 0x33, 0x09, 0x5c, 0x1a,
+	0xab, 0x49, 0x6f, 0xfa, 0x9b, 0xf7, 0xa2, 0x46, 0x45, 0xef, 0x02, 0xb2, 0xb4, 0x73, 0x75, 0xb9,
+	0x86, 0xd9, 0x35, 0x0a, 0x4b, 0x1b, 0x14, 0xc4, 0x5e, 0xc2, 0xd4, 0x91, 0xa0, 0xde, 0xe5, 0x49,
+	0x91, 0x2c, 0x67, 0x3c, 0x12, 0x7b, 0x03, 0x8b, 0xed, 0x98, 0xf4, 0xbd, 0xe9, 0x30, 0xff, 0x2f,
+	0x5c, 0x9f, 0x06, 0xcb, 0xdf, 0x09, 0x9c, 0x5d, 0xe9, 0xb6, 0x45, 0x19, 0x94, 0x7a, 0x43, 0x3e,
+	0x35, 0x2a, 0x0d, 0xc4, 0x72, 0x38, 0x93, 0xa6, 0x17, 0x56, 0x6e, 0xa3, 0xc6, 0x88, 0xfe, 0x85,
+	0x34, 0xbd, 0xea, 0xbb, 0x3c, 0x2d, 0x92, 0xe5, 0x84, 0x47, 0x62, 0xaf, 0xe0, 0xbc, 0xc3, 0x8e,
+	0x34, 0x89, 0x36, 0xcf, 0xc2, 0x93, 0x3d, 0x7b, 0xb5, 0x2b, 0xdd, 0x86, 0x8e, 0x26, 0x83, 0x5a,
+	0xc4, 0xb2, 0x80, 0x8c, 0x9b, 0xce, 0xf9, 0x0c, 0x6b, 0xba, 0xb6, 0x71, 0x94, 0x27, 0x45, 0xea,
+	0x33, 0x22, 0x96, 0xdf, 0x60, 0xf6, 0xc3, 0x54, 0x82, 0xf0, 0xb3, 0xab, 0x59, 0x09, 0xf3, 0x3e,
+	0x80, 0x7b, 0x68, 0x48, 0x6e, 0x43, 0xd3, 0xe7, 0xfc, 0x24, 0xc6, 0x0a, 0xb8, 0xd0, 0x06, 0xad,
+	0xa0, 0x46, 0xab, 0x75, 0x15, 0xdb, 0x3f, 0x0e, 0x95, 0x3f, 0x01, 0xb8, 0x91, 0x1c, 0xef, 0x7a,
+	0x74, 0xc4, 0x5e, 0xc3, 0xcc, 0x0e, 0xc7, 0x75, 0x15, 0x04, 0x33, 0x7e, 0x08, 0x30, 0x06, 0x19,
+	0xed, 0xcc, 0x30, 0xc9, 0x8c, 0x87, 0xb3, 0x6f, 0xd6, 0x88, 0x5d, 0xab, 0x45, 0x15, 0x66, 0x30,
+	0xe7, 0x23, 0x96, 0x1a, 0x2e, 0x82, 0xb2, 0x33, 0x5a, 0x39, 0xfc, 0x97, 0xd2, 0xec, 0x12, 0x26,
+	0x68, 0xad, 0xb6, 0x71, 0xb8, 0x03, 0x94, 0x7f, 0x12, 0xc8, 0x56, 0x3d, 0x6d, 0xfd, 0x35, 0xe9,
+	0x5b, 0x54, 0xd1, 0xc7, 0x01, 0x7c, 0x03, 0xde, 0x4e, 0x47, 0xa2, 0x33, 0xa1, 0x4e, 0xca, 0x0f,
+	0x01, 0x7f, 0xeb, 0x9a, 0x5a, 0x09, 0xea, 0x2d, 0x86, 0x72, 0x33, 0x7e, 0x08, 0xf8, 0x56, 0xc2,
+	0x16, 0xae, 0xab, 0x58, 0x72, 0x44, 0x6f, 0xf5, 0x3d, 0x5a, 0xd7, 0x68, 0xe5, 0xf2, 0x49, 0x91,
+	0x2e, 0x17, 0x7c, 0xcf, 0xde, 0x21, 0x29, 0x8c, 0xd8, 0x34, 0x6d, 0x43, 0x0d, 0xba, 0x7c, 0x1a,
+	0xdc, 0x3c, 0x89, 0x95, 0xbf, 0x60, 0xee, 0x7b, 0xde, 0x8f, 0x29, 0x87, 0x33, 0xd7, 0x4b, 0x89,
+	0xce, 0x45, 0x43, 0x47, 0xf4, 0xcb, 0x66, 0x51, 0x38, 0xad, 0xa2, 0x8d, 0x91, 0xfc, 0x8b, 0x58,
+	0x31, 0xf4, 0xbd, 0xe0, 0x23, 0x3e, 0xa9, 0x9f, 0x3d, 0x53, 0xff, 0x1a, 0xa6, 0x9f, 0xf4, 0xea,
+	0x41, 0xec, 0x8e, 0xf4, 0x93, 0x13, 0xfd, 0xb7, 0xf0, 0xbf, 0x45, 0xa9, 0x95, 0x42, 0x49, 0xab,
+	0x1b, 0x42, 0x1b, 0xea, 0x4f, 0xf8, 0xa3, 0x68, 0xf9, 0x11, 0xb2, 0xaf, 0x8d, 0xaa, 0xd9, 0x0b,
+	0x48, 0x1d, 0xde, 0x45, 0x8b, 0xfd, 0xd1, 0xcf, 0xc8, 0xa1, 0xaa, 0xf6, 0x5f, 0x61, 0xca, 0xf7,
+	0x5c, 0xde, 0xc3, 0xfc, 0xcb, 0xb8, 0x8e, 0x2b, 0x79, 0xfb, 0x78, 0x63, 0x93, 0x27, 0x1b, 0xeb,
+	0xdd, 0x75, 0x24, 0xea, 0x41, 0x6a, 0xc1, 0x07, 0x38, 0x9e, 0x5b, 0x7a, 0x3a, 0xb7, 0x67, 0x97,
+	0x65, 0x33, 0x0d, 0xff, 0x93, 0x0f, 0x7f, 0x07, 0x00, 0x9d, 0x2e, 0xc6, 0xa5, 0x67, 0x04, 0x00,
+	0x00,
 }
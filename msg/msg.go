@@ -7,6 +7,31 @@ const CLIENT_MSG_COLLECT = 2
 const SERVER_MSG_HEARTBEAT_RESPONSE = 3
 const CLIENT_MSG_RPMS = 4
 const SERVER_MSG_AGENT_UPDATE = 5
+const SERVER_MSG_RPC_REQUEST = 6
+const CLIENT_MSG_RPC_RESPONSE = 7
+const CLIENT_MSG_AUTH = 8
+const SERVER_MSG_AUTH_RESPONSE = 9
+const SERVER_MSG_GOAWAY = 10
+const SERVER_MSG_PING = 11
+const CLIENT_MSG_PONG = 12
+const CLIENT_MSG_OPERATION_ACK = 13
+
+// 协议版本
+// 版本1: 8字节消息体长度 + 4字节消息类型
+// 版本2: 报文头与版本1相同，消息类型字段的高8位为报文标记
+const PROTOCOL_VERSION_1 = 1
+const PROTOCOL_VERSION_2 = 2
+
+// 能力，在认证报文中协商
+const CAPABILITY_GZIP = "gzip"
+const CAPABILITY_PING = "ping"
+
+// 报文标记，协议版本2中位于消息类型字段的高8位
+const FRAME_FLAG_GZIP = 0x01
+
+// 操作确认的阶段
+const OPERATION_ACK_RECEIVED = 1
+const OPERATION_ACK_COMPLETED = 2
 
 // Msg ...
 // 消息
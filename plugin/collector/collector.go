@@ -1,16 +1,25 @@
 package collector
 
 import (
-	"github.com/golang/protobuf/proto"
 	log "microserver/common/formatlog"
 	"microserver/msg"
+	"microserver/server"
 )
 
-func HandleCollectData(clientId string, agentMsg *msg.Msg) {
-	collectMsg := &msg.Collect{}
-	if err := proto.Unmarshal(agentMsg.RawDatas, collectMsg); err != nil {
-		log.Errorf("[Collect] 解析收集项信息失败 %s, 失败原因 %s", clientId, err.Error())
-		return
+// 注册收集项的消息处理
+func Init() error {
+	if err := server.Ioserver.RegistMsgHandler(msg.CLIENT_MSG_COLLECT, &msg.Collect{}, HandleCollectData); err != nil {
+		return err
 	}
-	log.Debugf("[Collect] 接收到 %s 的收集项，开机时间: %s，cpu架构: %s，Cpu数量: %d, 总内存: %s, 收集时间: %s", clientId, collectMsg.Uptime, collectMsg.Cpuarch, collectMsg.Cpunum, collectMsg.Memtotal, collectMsg.ColTime)
+	return server.Ioserver.RegistMsgHandler(msg.CLIENT_MSG_RPMS, &msg.Rpms{}, HandleRpmsData)
+}
+
+func HandleCollectData(client *server.Client, agentMsg *msg.Msg) {
+	collectMsg := agentMsg.Msg.(*msg.Collect)
+	log.Debugf("[Collect] 接收到 %s 的收集项，开机时间: %s，cpu架构: %s，Cpu数量: %d, 总内存: %s, 收集时间: %s", client.GetClientId(), collectMsg.Uptime, collectMsg.Cpuarch, collectMsg.Cpunum, collectMsg.Memtotal, collectMsg.ColTime)
+}
+
+func HandleRpmsData(client *server.Client, agentMsg *msg.Msg) {
+	rpmsMsg := agentMsg.Msg.(*msg.Rpms)
+	log.Debugf("[Collect] 接收到 %s 的RPM信息，RPM数量: %d", client.GetClientId(), len(rpmsMsg.Rpmlist))
 }
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"fmt"
+	"microserver/common"
+	cfg "microserver/common/configparse"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+连接准入控制，在创建Client之前检查，microserver.ini 中的 [access]:
+- allow: 允许连接的网段，逗号分隔的CIDR或者IP，为空表示允许所有地址
+- deny: 拒绝连接的网段，逗号分隔的CIDR或者IP，优先于allow
+- maxconns: 最大连接数，0表示不限制(默认)
+- maxconnsperip: 每个对端IP的最大连接数，0表示不限制(默认)
+[access] 中的规则和连接数对所有监听(包括WebSocket接入)共同生效，
+监听自己的配置段中可以配置同名的配置项，在全局规则之上对该监听额外限制
+配置文件重新加载后调用 ReloadAccessPolicy 生效，已经建立的连接不受影响
+*/
+
+const (
+	acceptMinBackoff = 5 * time.Millisecond
+	acceptMaxBackoff = time.Second
+)
+
+type accessPolicy struct {
+	allow         []*net.IPNet
+	deny          []*net.IPNet
+	maxConns      int
+	maxConnsPerIp int
+}
+
+// 准入统计
+type AccessStats struct {
+	Connections   int64  `json:"connections"`   // 当前连接数
+	DeniedConns   uint64 `json:"deniedconns"`   // 因为访问规则被拒绝的连接数
+	OverflowConns uint64 `json:"overflowconns"` // 因为超过连接数限制被拒绝的连接数
+}
+
+type accessControl struct {
+	section  string       // 准入配置所在的配置段
+	policy   atomic.Value // *accessPolicy
+	connLock *sync.Mutex
+	ipConns  map[string]int // 每个对端IP的连接数
+	stats    AccessStats
+}
+
+// 解析逗号分隔的CIDR列表，单个IP按照主机地址处理
+func parseCidrList(value string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, se.New(fmt.Sprintf("不合法的IP地址: %s", item))
+			}
+			if ip.To4() != nil {
+				item = item + "/32"
+			} else {
+				item = item + "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, se.New(fmt.Sprintf("不合法的网段: %s", item))
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func loadAccessPolicy(section string) (*accessPolicy, error) {
+	allow, err := parseCidrList(cfg.GlobalConf.GetStr(section, "allow"))
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseCidrList(cfg.GlobalConf.GetStr(section, "deny"))
+	if err != nil {
+		return nil, err
+	}
+	maxConns := cfg.GlobalConf.GetInt(section, "maxconns")
+	maxConnsPerIp := cfg.GlobalConf.GetInt(section, "maxconnsperip")
+	return &accessPolicy{
+		allow:         allow,
+		deny:          deny,
+		maxConns:      maxConns,
+		maxConnsPerIp: maxConnsPerIp,
+	}, nil
+}
+
+func newAccessControl(section string) (*accessControl, error) {
+	policy, err := loadAccessPolicy(section)
+	if err != nil {
+		return nil, err
+	}
+	a := &accessControl{
+		section:  section,
+		connLock: &sync.Mutex{},
+		ipConns:  map[string]int{},
+	}
+	a.policy.Store(policy)
+	return a, nil
+}
+
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 对端IP是否允许连接
+func (p *accessPolicy) permit(ip net.IP) bool {
+	if ipInNets(ip, p.deny) {
+		return false
+	}
+	return len(p.allow) == 0 || ipInNets(ip, p.allow)
+}
+
+// 按照最新的配置重新生成访问规则，配置不合法时保留原有规则
+func (a *accessControl) reload() error {
+	policy, err := loadAccessPolicy(a.section)
+	if err != nil {
+		log.Errorf("[IOServer] [%s] 访问规则加载失败，继续使用原有规则: %s", a.section, err.Error())
+		return err
+	}
+	a.policy.Store(policy)
+	log.Infof("[IOServer] [%s] 访问规则已更新, allow: %d 条, deny: %d 条, maxconns: %d, maxconnsperip: %d", a.section, len(policy.allow), len(policy.deny), policy.maxConns, policy.maxConnsPerIp)
+	return nil
+}
+
+// 重新加载所有监听的访问规则，返回第一个加载失败的错误
+func (s *IoServer) ReloadAccessPolicy() error {
+	var firstErr error
+	for _, a := range s.accessControls() {
+		if err := a.reload(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// 按照一组规则检查新连接是否允许接入，允许时登记连接，连接结束后需要调用 release
+func (a *accessControl) admit(remoteAddr string, agentIp string) bool {
+	policy := a.policy.Load().(*accessPolicy)
+	ip := common.ParseIp(agentIp)
+	if ip == nil {
+		atomic.AddUint64(&a.stats.DeniedConns, 1)
+		log.Warnf("[IOServer] [%s] 对端 %s 的IP %s 不合法，拒绝连接", a.section, remoteAddr, agentIp)
+		return false
+	}
+	if !policy.permit(ip) {
+		atomic.AddUint64(&a.stats.DeniedConns, 1)
+		log.Warnf("[IOServer] [%s] 对端 %s 不在允许的访问范围内，拒绝连接", a.section, remoteAddr)
+		return false
+	}
+
+	a.connLock.Lock()
+	defer a.connLock.Unlock()
+	if policy.maxConns > 0 && atomic.LoadInt64(&a.stats.Connections) >= int64(policy.maxConns) {
+		atomic.AddUint64(&a.stats.OverflowConns, 1)
+		log.Warnf("[IOServer] [%s] 连接数达到上限 %d，拒绝 %s 的连接", a.section, policy.maxConns, remoteAddr)
+		return false
+	}
+	if policy.maxConnsPerIp > 0 && a.ipConns[agentIp] >= policy.maxConnsPerIp {
+		atomic.AddUint64(&a.stats.OverflowConns, 1)
+		log.Warnf("[IOServer] [%s] %s 的连接数达到上限 %d，拒绝 %s 的连接", a.section, agentIp, policy.maxConnsPerIp, remoteAddr)
+		return false
+	}
+	a.ipConns[agentIp]++
+	atomic.AddInt64(&a.stats.Connections, 1)
+	return true
+}
+
+// 连接结束后释放登记
+func (a *accessControl) release(agentIp string) {
+	a.connLock.Lock()
+	defer a.connLock.Unlock()
+	if a.ipConns[agentIp]--; a.ipConns[agentIp] <= 0 {
+		delete(a.ipConns, agentIp)
+	}
+	atomic.AddInt64(&a.stats.Connections, -1)
+}
+
+// 检查新连接是否允许接入，先检查全局规则，再检查监听自己的规则
+// 允许时在两处同时登记，连接结束后需要调用 releaseConn
+func (s *IoServer) admitConn(local *accessControl, remoteAddr string, agentIp string) bool {
+	if !s.globalAccess.admit(remoteAddr, agentIp) {
+		return false
+	}
+	if !local.admit(remoteAddr, agentIp) {
+		s.globalAccess.release(agentIp)
+		return false
+	}
+	return true
+}
+
+// 连接结束后释放全局和监听的登记
+func (s *IoServer) releaseConn(local *accessControl, agentIp string) {
+	local.release(agentIp)
+	s.globalAccess.release(agentIp)
+}
+
+// 接受连接失败后的等待时间，连续失败时指数增加
+func acceptBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return acceptMinBackoff
+	}
+	if backoff *= 2; backoff > acceptMaxBackoff {
+		return acceptMaxBackoff
+	}
+	return backoff
+}
+
+func (a *accessControl) getStats() AccessStats {
+	return AccessStats{
+		Connections:   atomic.LoadInt64(&a.stats.Connections),
+		DeniedConns:   atomic.LoadUint64(&a.stats.DeniedConns),
+		OverflowConns: atomic.LoadUint64(&a.stats.OverflowConns),
+	}
+}
+
+// 获取准入统计，key为准入配置所在的配置段
+func (s *IoServer) GetAccessStats() map[string]AccessStats {
+	result := map[string]AccessStats{}
+	for _, a := range s.accessControls() {
+		result[a.section] = a.getStats()
+	}
+	return result
+}
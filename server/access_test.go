@@ -0,0 +1,94 @@
+package server
+
+import (
+	"testing"
+)
+
+func newTestAccess(t *testing.T, section string) *accessControl {
+	a, err := newAccessControl(section)
+	if err != nil {
+		t.Fatalf("生成 %s 的准入控制失败: %v", section, err)
+	}
+	return a
+}
+
+// 全局连接数限制对所有监听共同生效
+func TestAdmitConnGlobalLimit(t *testing.T) {
+	setTestConf(t, "[access]\nmaxconns = 2\nmaxconnsperip = 1\n[listener.local]\nmaxconns = 1\n")
+	s := newTestServer()
+	s.globalAccess = newTestAccess(t, "access")
+	tcp := newTestAccess(t, "listener.default")
+	local := newTestAccess(t, "listener.local")
+	ws := newTestAccess(t, "websocket")
+
+	if !s.admitConn(tcp, "10.0.0.1:1000", "10.0.0.1") {
+		t.Fatal("第一个连接应该被允许")
+	}
+	// 不同监听上同一个IP的连接共享全局的每IP限制
+	if s.admitConn(ws, "10.0.0.1:1001", "10.0.0.1") {
+		t.Error("超过全局每IP连接数限制的连接应该被拒绝")
+	}
+	if !s.admitConn(local, "10.0.0.2:1000", "10.0.0.2") {
+		t.Fatal("第二个连接应该被允许")
+	}
+	// 不同监听的连接共享全局连接数限制
+	if s.admitConn(ws, "10.0.0.3:1000", "10.0.0.3") {
+		t.Error("超过全局连接数限制的连接应该被拒绝")
+	}
+
+	s.releaseConn(tcp, "10.0.0.1")
+	// 监听自己的限制在全局限制之上生效，被拒绝时不占用全局计数
+	if s.admitConn(local, "10.0.0.3:1000", "10.0.0.3") {
+		t.Error("超过监听连接数限制的连接应该被拒绝")
+	}
+	if !s.admitConn(ws, "10.0.0.3:1001", "10.0.0.3") {
+		t.Error("释放连接后新的连接应该被允许")
+	}
+	if got := s.globalAccess.getStats().Connections; got != 2 {
+		t.Errorf("全局连接数为 %d，期望 2", got)
+	}
+}
+
+func TestAdmitConnAllowDeny(t *testing.T) {
+	setTestConf(t, "[access]\nallow = 10.0.0.0/8, ::1\ndeny = 10.0.1.0/24\n[websocket]\ndeny = 10.0.2.1\n")
+	s := newTestServer()
+	s.globalAccess = newTestAccess(t, "access")
+	tcp := newTestAccess(t, "listener.default")
+	ws := newTestAccess(t, "websocket")
+
+	cases := []struct {
+		local *accessControl
+		ip    string
+		want  bool
+	}{
+		{local: tcp, ip: "10.0.0.1", want: true},
+		{local: tcp, ip: "::1", want: true},
+		{local: tcp, ip: "192.168.0.1", want: false},
+		{local: tcp, ip: "10.0.1.1", want: false},
+		{local: tcp, ip: "10.0.2.1", want: true},
+		{local: ws, ip: "10.0.2.1", want: false},
+	}
+	for _, c := range cases {
+		if got := s.admitConn(c.local, c.ip, c.ip); got != c.want {
+			t.Errorf("%s 的 %s 准入结果为 %v，期望 %v", c.local.section, c.ip, got, c.want)
+		}
+	}
+}
+
+// 带zone的IPv6地址同样按照访问规则检查，不合法的IP拒绝接入
+func TestAdmitConnZonedIp(t *testing.T) {
+	setTestConf(t, "[access]\ndeny = fe80::/10\n")
+	s := newTestServer()
+	s.globalAccess = newTestAccess(t, "access")
+	tcp := newTestAccess(t, "listener.default")
+
+	if s.admitConn(tcp, "[fe80::1%eth0]:1234", "fe80::1%eth0") {
+		t.Error("deny 网段内带zone的IPv6地址应该被拒绝")
+	}
+	if !s.admitConn(tcp, "[fd00::1]:1234", "fd00::1") {
+		t.Error("deny 网段外的IPv6地址应该被允许")
+	}
+	if s.admitConn(tcp, "agent:1234", "agent") {
+		t.Error("不合法的IP应该被拒绝")
+	}
+}
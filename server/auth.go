@@ -0,0 +1,207 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	cfg "microserver/common/configparse"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"microserver/controller"
+	"microserver/msg"
+	"regexp"
+	"sync"
+	"time"
+)
+
+/*
+	认证配置, microserver.ini 中的 [auth] 段:
+	- timeout: 连接建立后等待认证报文的时间，单位秒
+	- hmacskew: HMAC签名中时间戳允许的偏差，单位秒，偏差内同一个签名只能使用一次
+*/
+
+const (
+	defaultAuthTimeout  = 10
+	defaultAuthHmacSkew = 300
+	// 清理过期签名记录的间隔，单位秒
+	defaultAuthReplayPurge = 60
+)
+
+// 认证失败时返回给agent的原因
+const (
+	authReasonFailed    = "认证失败"
+	authReasonDuplicate = "duplicate" // reject策略下agent已经连接
+)
+
+// agentId 只允许字母、数字以及 . _ : - 字符
+var agentIdRegexp = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// 等待并校验agent的认证报文，返回agent声明的ID，认证失败时返回错误，调用方负责关闭连接
+// certId 为TLS证书中的身份，不为空时agent声明的ID必须与其一致
+func (s *IoServer) authenticate(client *Client, certId string) (string, error) {
+	authTimeout := cfg.GlobalConf.GetInt("auth", "timeout")
+	if authTimeout <= 0 {
+		authTimeout = defaultAuthTimeout
+	}
+	// 超时未完成认证则直接关闭连接，GetMsg会因此返回错误
+	timer := time.AfterFunc(time.Duration(authTimeout)*time.Second, func() {
+		log.Warnf("[IOServer] %s 在 %d 秒内没有完成认证，关闭连接", client.clientId, authTimeout)
+		client.Close()
+	})
+	defer timer.Stop()
+
+	agentMsg, err := client.GetMsg()
+	if err != nil {
+		return "", err
+	}
+	if agentMsg.Type != msg.CLIENT_MSG_AUTH {
+		err := se.New(fmt.Sprintf("%s 的第一个报文不是认证报文，消息类型: %d", client.clientId, agentMsg.Type))
+		s.sendAuthResponse(client, err, authReasonFailed, nil)
+		return "", err
+	}
+
+	authMsg := &msg.Auth{}
+	if err := proto.Unmarshal(agentMsg.RawDatas, authMsg); err != nil {
+		log.Errorf("[IOServer] 解析认证信息失败 %s, 失败原因 %s", client.clientId, err.Error())
+		s.sendAuthResponse(client, err, authReasonFailed, nil)
+		return "", err
+	}
+
+	if !agentIdRegexp.MatchString(authMsg.AgentId) {
+		err := se.New(fmt.Sprintf("%s 声明的AgentID %q 不合法", client.clientId, authMsg.AgentId))
+		s.sendAuthResponse(client, err, authReasonFailed, nil)
+		return "", err
+	}
+	if certId != "" && certId != authMsg.AgentId {
+		err := se.New(fmt.Sprintf("%s 声明的AgentID %s 与证书身份 %s 不一致", client.clientId, authMsg.AgentId, certId))
+		s.sendAuthResponse(client, err, authReasonFailed, nil)
+		return "", err
+	}
+
+	err = s.verifyAuth(authMsg.AgentId, authMsg)
+	reason := authReasonFailed
+	var negotiated *protocolNegotiation
+	if err == nil {
+		negotiated, err = negotiateProtocol(authMsg.Versions, authMsg.Capabilities)
+	}
+	// 重复连接在返回认证结果之前拒绝，避免agent认为登录成功后又被断开
+	if err == nil {
+		if err = s.checkDuplicate(authMsg.AgentId); err != nil {
+			reason = authReasonDuplicate
+		}
+	}
+	s.sendAuthResponse(client, err, reason, negotiated)
+	if err != nil {
+		return "", err
+	}
+	// 认证响应使用版本1发送，之后的报文使用协商后的版本
+	client.setProtocol(negotiated)
+	return authMsg.AgentId, nil
+}
+
+// 根据数据库中的密钥校验token或HMAC签名
+func (s *IoServer) verifyAuth(agentId string, authMsg *msg.Auth) error {
+	secret, err := controller.Agentctrl.GetAgentSecret(agentId)
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return se.New(fmt.Sprintf("Agent %s 的认证密钥为空", agentId))
+	}
+
+	if authMsg.Signature != "" {
+		return s.verifySignature(agentId, secret, authMsg)
+	}
+
+	if authMsg.Token == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(authMsg.Token)) != 1 {
+		return se.New(fmt.Sprintf("Agent %s 的token校验失败", agentId))
+	}
+	return nil
+}
+
+// 校验HMAC签名，签名只覆盖 agentId:timestamp，同一个签名在允许的偏差内只能使用一次，防止认证报文被重放
+func (s *IoServer) verifySignature(agentId string, secret string, authMsg *msg.Auth) error {
+	skew := cfg.GlobalConf.GetInt("auth", "hmacskew")
+	if skew <= 0 {
+		skew = defaultAuthHmacSkew
+	}
+	now := time.Now().Unix()
+	diff := now - authMsg.Timestamp
+	if diff > int64(skew) || diff < -int64(skew) {
+		return se.New(fmt.Sprintf("Agent %s 的签名时间戳 %d 超出允许的偏差 %d 秒", agentId, authMsg.Timestamp, skew))
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%s:%d", agentId, authMsg.Timestamp)))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(authMsg.Signature)) {
+		return se.New(fmt.Sprintf("Agent %s 的签名校验失败", agentId))
+	}
+	// 时间戳超出偏差后签名本身就会失效，只需要记录到 timestamp+skew
+	if !s.authReplay.use(agentId, authMsg.Timestamp, authMsg.Timestamp+int64(skew), now) {
+		return se.New(fmt.Sprintf("Agent %s 的签名已经使用过，时间戳 %d", agentId, authMsg.Timestamp))
+	}
+	return nil
+}
+
+// 已经使用过的签名，key为 agentId:timestamp，value为过期时间
+type authReplayCache struct {
+	lock      *sync.Mutex
+	used      map[string]int64
+	nextPurge int64 // 下一次清理过期记录的时间
+}
+
+func newAuthReplayCache() *authReplayCache {
+	return &authReplayCache{
+		lock: &sync.Mutex{},
+		used: map[string]int64{},
+	}
+}
+
+// 登记一次签名的使用，签名已经使用过时返回false
+func (c *authReplayCache) use(agentId string, timestamp int64, expire int64, now int64) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if now >= c.nextPurge {
+		for key, keyExpire := range c.used {
+			if keyExpire < now {
+				delete(c.used, key)
+			}
+		}
+		c.nextPurge = now + defaultAuthReplayPurge
+	}
+	key := fmt.Sprintf("%s:%d", agentId, timestamp)
+	if keyExpire, ok := c.used[key]; ok && keyExpire >= now {
+		return false
+	}
+	c.used[key] = expire
+	return true
+}
+
+// 返回认证结果，认证成功时携带协商后的协议版本和能力，失败时携带 reason
+func (s *IoServer) sendAuthResponse(client *Client, authErr error, reason string, negotiated *protocolNegotiation) {
+	authResponse := &msg.AuthResponse{Success: true}
+	if negotiated != nil {
+		authResponse.Version = negotiated.version
+		authResponse.Capabilities = negotiated.capabilities
+	}
+	if authErr != nil {
+		log.Errorf("[IOServer] %s 认证失败: %s", client.clientId, authErr.Error())
+		// 具体原因只记录在服务端日志中
+		authResponse = &msg.AuthResponse{Success: false, Reason: reason}
+	} else {
+		log.Infof("[IOServer] %s 认证成功", client.clientId)
+	}
+	// 等待写入完成，保证认证响应在协议版本切换之前发送
+	client.SendMsgWait(&msg.Msg{
+		Type: msg.SERVER_MSG_AUTH_RESPONSE,
+		Msg:  authResponse,
+	})
+}
+
+// 认证完成后重复发送的认证报文直接忽略
+func (s *IoServer) handleClientRepeatedAuthMsg(client *Client, agentMsg *msg.Msg) {
+	log.Warnf("[IOServer] %s 已经认证，忽略重复的认证报文", client.clientId)
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"microserver/msg"
+	"testing"
+	"time"
+)
+
+func signAuth(agentId string, secret string, timestamp int64) *msg.Auth {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%s:%d", agentId, timestamp)))
+	return &msg.Auth{
+		AgentId:   agentId,
+		Timestamp: timestamp,
+		Signature: hex.EncodeToString(mac.Sum(nil)),
+	}
+}
+
+// 同一个签名在允许的偏差内只能使用一次
+func TestVerifySignatureRejectsReplay(t *testing.T) {
+	setTestConf(t, "[auth]\nhmacskew = 300\n")
+	s := newTestServer()
+	s.authReplay = newAuthReplayCache()
+	now := time.Now().Unix()
+
+	authMsg := signAuth("agent-1", "secret", now)
+	if err := s.verifySignature("agent-1", "secret", authMsg); err != nil {
+		t.Fatalf("第一次使用签名校验失败: %v", err)
+	}
+	if err := s.verifySignature("agent-1", "secret", authMsg); err == nil {
+		t.Error("重放的签名应该被拒绝")
+	}
+	if err := s.verifySignature("agent-1", "secret", signAuth("agent-1", "secret", now-1)); err != nil {
+		t.Errorf("新的时间戳签名校验失败: %v", err)
+	}
+	if err := s.verifySignature("agent-2", "secret", signAuth("agent-2", "secret", now)); err != nil {
+		t.Errorf("其它agent相同时间戳的签名校验失败: %v", err)
+	}
+	// 签名错误的报文不登记，不影响之后正确的签名
+	forged := signAuth("agent-3", "wrong", now)
+	if err := s.verifySignature("agent-3", "secret", forged); err == nil {
+		t.Error("错误的签名应该被拒绝")
+	}
+	if err := s.verifySignature("agent-3", "secret", signAuth("agent-3", "secret", now)); err != nil {
+		t.Errorf("错误签名之后正确的签名校验失败: %v", err)
+	}
+	if err := s.verifySignature("agent-1", "secret", signAuth("agent-1", "secret", now-600)); err == nil {
+		t.Error("超出偏差的签名应该被拒绝")
+	}
+}
+
+func TestAuthReplayCachePurge(t *testing.T) {
+	c := newAuthReplayCache()
+	if !c.use("agent-1", 100, 200, 100) {
+		t.Fatal("第一次使用应该成功")
+	}
+	if c.use("agent-1", 100, 200, 150) {
+		t.Error("过期之前重复使用应该失败")
+	}
+	if !c.use("agent-2", 300, 400, 300) {
+		t.Fatal("第一次使用应该成功")
+	}
+	if _, ok := c.used["agent-1:100"]; ok {
+		t.Error("过期的记录应该被清理")
+	}
+}
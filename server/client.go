@@ -1,9 +1,7 @@
 package server
 
 import (
-	"bytes"
 	"fmt"
-	"github.com/golang/protobuf/proto"
 	"microserver/common"
 	cfg "microserver/common/configparse"
 	se "microserver/common/error"
@@ -11,215 +9,199 @@ import (
 	"microserver/msg"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Client struct {
-	clientId              string      //客户端ID
-	state                 int         // agent 状态字段
-	conn                  net.Conn    // agent的Conn
-	sendLock              *sync.Mutex // 发送锁
-	readBuf               []byte      // 读取的缓存
-	readMsgPayloadLth     uint64      // 读取的当前消息的长度
-	readTotalBytesLth     uint64      // 读取的总的消息长度
-	lastHeartbeatSyncTime string      // 最近一次心跳同步时间
-	readTimeout           int         // 读超时
-	writeTimeout          int         // 写超时
-	agentHeartbeatTimeout int         // heartbeat超时时间，单位分钟
+	clientId              string                     //客户端ID，agent声明的唯一ID
+	agentIp               string                     // agent当前的IP
+	state                 int32                      // agent 状态字段
+	conn                  net.Conn                   // agent的Conn
+	sendLock              *sync.Mutex                // 发送锁
+	reader                *frameReader               // 报文读取
+	readTotalBytesLth     uint64                     // 读取的总的消息长度
+	sentTotalBytesLth     uint64                     // 发送的总的报文长度
+	connectTime           time.Time                  // 建立连接的时间
+	statsLock             *sync.Mutex                // 连接统计锁
+	recvMsgCount          map[uint64]uint64          // 按消息类型统计的接收消息数
+	sentMsgCount          map[uint64]uint64          // 按消息类型统计的发送消息数
+	lastHeartbeatSyncTime string                     // agent上报的最近一次心跳时间，仅用于展示
+	lastHeartbeatTime     time.Time                  // 服务端最近一次收到心跳的时间
+	lastRecvTime          int64                      // 服务端最近一次收到报文的时间，UnixNano
+	readTimeout           int                        // 读超时
+	writeTimeout          int                        // 写超时
+	agentHeartbeatTimeout int                        // heartbeat超时时间，单位分钟
+	pendingLock           *sync.Mutex                // 同步请求锁
+	pendingCalls          map[uint64]chan *rpcResult // 等待响应的同步请求
+	pendingClosed         bool                       // 连接断开后不再接受同步请求
+	maxPayloadSize        uint64                     // 允许的最大消息体长度
+	knownMsgType          func(uint64) bool          // 判断消息类型是否合法，为nil时不校验
+	violations            ProtocolViolations         // 协议违规计数
+	protoVersion          uint32                     // 协商后的协议版本
+	capabilities          map[string]bool            // 协商后的能力
+	compressThreshold     int                        // 压缩阈值
+	compression           CompressionStats           // 压缩统计
+	sendQueue             chan *sendItem             // 发送队列
+	sendQueuePolicy       string                     // 发送队列满时的处理策略
+	sendMaxDepth          uint64                     // 发送队列长度的历史最大值
+	sendDropped           uint64                     // 因为队列满被丢弃的消息数
+	closeOnce             *sync.Once                 // 保证连接只关闭一次
+	closeCh               chan struct{}              // 连接关闭信号
+	pingSeq               uint64                     // 探测报文序列
+	pingOutstanding       uint64                     // 等待响应的探测序列，0表示没有
+	pingSent              atomic.Value               // 最近一次发送的探测，*pingRecord
+	pingMissed            int32                      // 连续没有响应的探测次数
+	pingRtt               int64                      // 最近一次探测的往返时间，单位纳秒
+	lastPongTime          int64                      // 最近一次收到探测响应的时间，UnixNano
+	stateHook             StateChangeHook            // 状态变化回调，注册后设置
+	rateLimiter           *rateLimiter               // 接收限流，为nil表示不限制
+	rateLimit             RateLimitStats             // 限流统计
+	mailbox               chan *msg.Msg              // 待处理的消息
+	mailboxScheduled      int32                      // 是否已经交给处理协程池，1表示是
 }
 
-// Client初始化
-func NewClient(conn net.Conn, clientId string) *Client {
+// Client初始化，认证完成前clientId暂时使用agent的IP
+func NewClient(conn net.Conn, agentIp string) *Client {
 	client := Client{
 		conn:                  conn,
-		clientId:              clientId,
-		readBuf:               []byte{},
-		readMsgPayloadLth:     0,
+		clientId:              agentIp,
+		agentIp:               agentIp,
+		reader:                newFrameReader(conn),
 		state:                 Waiting,
 		lastHeartbeatSyncTime: "1970-01-01 00:00:00",
 		sendLock:              &sync.Mutex{},
 		readTotalBytesLth:     0,
+		sentTotalBytesLth:     0,
+		connectTime:           time.Now(),
+		statsLock:             &sync.Mutex{},
+		recvMsgCount:          map[uint64]uint64{},
+		sentMsgCount:          map[uint64]uint64{},
 		readTimeout:           cfg.GlobalConf.GetInt("common", "readtimeout"),
 		writeTimeout:          cfg.GlobalConf.GetInt("common", "writeimeout"),
-		agentHeartbeatTimeout: cfg.GlobalConf.GetInt("common", "agentHeartbeatTimeout"),
+		agentHeartbeatTimeout: agentHeartbeatTimeout(),
+		lastRecvTime:          time.Now().UnixNano(),
+		pendingLock:           &sync.Mutex{},
+		pendingCalls:          map[uint64]chan *rpcResult{},
+		pendingClosed:         false,
+		maxPayloadSize:        maxPayloadSize(),
+		protoVersion:          msg.PROTOCOL_VERSION_1,
+		capabilities:          map[string]bool{},
+		compressThreshold:     compressThreshold(),
+		sendQueue:             make(chan *sendItem, sendQueueSize()),
+		sendQueuePolicy:       sendQueuePolicy(),
+		closeOnce:             &sync.Once{},
+		closeCh:               make(chan struct{}),
+		rateLimiter:           newRateLimiter(),
+		mailbox:               make(chan *msg.Msg, workerQueueSize()),
 	}
+	// 启动写协程，调用方需要在连接结束时调用Close
+	go client.writeLoop()
 	return &client
 }
 
+// 获取客户端ID
+func (c *Client) GetClientId() string {
+	return c.clientId
+}
+
+// 获取客户端状态
+func (c *Client) GetState() int {
+	return int(atomic.LoadInt32(&c.state))
+}
+
+// 设置客户端状态，状态变化时通知订阅者
+func (c *Client) setState(newState int) {
+	oldState := int(atomic.SwapInt32(&c.state, int32(newState)))
+	if oldState == newState {
+		return
+	}
+	log.Debugf("[IOServer] %s 状态变化 %d -> %d", c.clientId, oldState, newState)
+	if c.stateHook != nil {
+		c.stateHook(c, oldState, newState)
+	}
+}
+
+// 获取客户端当前的IP
+func (c *Client) GetAgentIp() string {
+	return c.agentIp
+}
+
 // 设置最近一次心跳同步时间
 func (c *Client) SetLastHeartbeatSyncTime(t string) {
 	log.Debugf("[IOServer]  %s 的心跳时间更新为 %s", c.clientId, t)
+	c.statsLock.Lock()
 	c.lastHeartbeatSyncTime = t
+	c.lastHeartbeatTime = time.Now()
+	c.statsLock.Unlock()
 }
 
-// 客户端是否有效
-func (c *Client) Valid() bool {
-	if c.state == Erroring {
-		return false
+// 读取一个消息
+func (c *Client) GetMsg() (*msg.Msg, error) {
+	if c.GetState() == Erroring {
+		log.Warnf("[IOServer] %s 无效，退出读消息循环", c.clientId)
+		return nil, se.New(fmt.Sprintf("%s 无效，退出读取循环", c.clientId))
 	}
 
-	// 如果最近一次心跳同步时间为默认值，等待下次检查
-	if c.lastHeartbeatSyncTime == "1970-01-01 00:00:00" {
-		return true
-	}
+	// 每个报文只设置一次读超时，超时时间从开始等待报文头算起
+	c.conn.SetReadDeadline(time.Now().Add(time.Duration(c.readTimeout) * time.Second))
 
-	now := time.Now()
-	h, _ := time.ParseDuration(fmt.Sprintf("-%dm", c.agentHeartbeatTimeout))
-	targetDate := now.Add(h)
-	targetDateStr := targetDate.Format(common.TIME_FORMAT)
-	if targetDateStr > c.lastHeartbeatSyncTime {
-		log.Errorf("[IOServer] 客户端 %s 的心跳时间 %s 超时，允许间隔 %d 分钟", c.clientId, targetDateStr, c.lastHeartbeatSyncTime)
-		return false
+	payloadLth, rawType, err := c.reader.readHeader()
+	if err != nil {
+		log.Errorf("[IOServer] 从 %s 读取报文头时报错，报错内容: %s", c.clientId, err.Error())
+		return nil, err
 	}
+	msgType, flags := c.splitFrameType(rawType)
 
-	return true
-}
+	// 先校验长度、类型和报文标记，避免为超大或者非法的报文分配内存
+	if err := c.checkFrameHeader(payloadLth, msgType, flags); err != nil {
+		c.setState(Erroring)
+		return nil, err
+	}
 
-// 读取一个消息
-func (c *Client) GetMsg() (*msg.Msg, error) {
-	/*
-		消息格式: 8字节protobuf报文长度 + 4字节类型 + protobuf报文
-		读取逻辑:
-		- 读取报文，将报文和client内部的buf相加，如果长度小于8则继续读取
-		- 如果长度大于8则根据计算得到的长度读取所有数据
-		- 读取后解析protobuf生成msg，并消耗相关的buf
-	*/
-
-	for {
-		if c.state == Erroring {
-			log.Warnf("[IOServer] %s 无效，退出读消息循环", c.clientId)
-			return nil, se.New(fmt.Sprintf("%s 无效，退出读取循环", c.clientId))
-		}
+	payload, err := c.reader.readPayload(payloadLth)
+	if err != nil {
+		log.Errorf("[IOServer] 从 %s 读取消息体时报错，报错内容: %s", c.clientId, err.Error())
+		return nil, err
+	}
+	readTotal := atomic.AddUint64(&c.readTotalBytesLth, frameHeaderLth+payloadLth)
+	c.countMsg(c.recvMsgCount, msgType)
+	c.touch()
 
-		// 设置读的超时时间
-		c.conn.SetReadDeadline(time.Now().Add(time.Duration(c.readTimeout) * time.Second))
-
-		if len(c.readBuf) < 8 {
-			// 长度信息还没有读取到
-			log.Debugf("[IOServer] 准备从 %s 读取报文，当前报文长度小于8", c.clientId)
-			readBuf := make([]byte, 512)
-			n, err := c.conn.Read(readBuf)
-			log.Debugf("[IOServer] 从 %s 读取到报文", c.clientId)
-			if err != nil {
-				log.Errorf("[IOServer] 从 %s 读取数据时报错，报错内容: %s", c.clientId, err.Error())
-				return nil, err
-			}
-			c.conn.SetReadDeadline(time.Time{})
-			log.Debugf("[IOServer] 此次读取到了 %d 字节的数据 %s", n, c.clientId)
-			log.Debugf("[IOServer] 读取到 %s 报文，内容: %v", c.clientId, readBuf[:n])
-			c.readBuf = append(c.readBuf, readBuf[:n]...)
-
-			// 判断长度，如果达到8了则生成payload长度
-			if len(c.readBuf) >= 8 {
-				c.readMsgPayloadLth = common.GenIntFromLength(c.readBuf[0:8])
-				log.Debugf("[IOServer] 读取到足够长度的报文，解析得到的报文长度为 %d, 报文长度元数据: %v, 客户端 %s, buf内容: %v", c.readMsgPayloadLth, c.readBuf[0:8], c.clientId, c.readBuf)
-			}
-		} else if c.readMsgPayloadLth+12 > uint64(len(c.readBuf)) {
-			log.Debugf("[IOServer] 报文长度信息已经都读取完成，但是整个报文还没有全部传输 %s。报文长度期望为 %d, 当前buf中的长度为 %d, buf内容: %v", c.clientId, c.readMsgPayloadLth, (len(c.readBuf) - 12), c.readBuf)
-			// 长度信息读取到了，但是payload没有读取完成
-			readBuf := make([]byte, 256)
-			n, err := c.conn.Read(readBuf)
-			if err != nil {
-				log.Errorf("[IOServer] 从 %s 读取数据时报错，报错内容: %s", c.clientId, err.Error())
-				return nil, err
-			}
-			c.conn.SetReadDeadline(time.Time{})
-			log.Debugf("[IOServer] 此次读取到了 %d 字节的数据 %s", n, c.clientId)
-			c.readBuf = append(c.readBuf, readBuf[:n]...)
-		} else {
-			log.Debugf("[IOServer] 报文已经都读取完成 %s", c.clientId)
-			c.conn.SetReadDeadline(time.Time{})
-			// 整个消息都读取到了，此时c.readBuf中可能包含一个或一个以上的消息内容
-			msgLength := 12 + c.readMsgPayloadLth
-			msgTypeBytes := c.readBuf[8:12]
-			log.Debugf("[IOServer] 报文总长度 %d, 消息类型 %d, 消息体长度 %d - %s", msgLength, common.GenIntFromType(msgTypeBytes), c.readMsgPayloadLth, c.clientId)
-
-			if c.readMsgPayloadLth == 0 {
-				// 不存在消息体
-				if uint64(len(c.readBuf)) == msgLength {
-					log.Debugf("[IOServer] msgLength %d", msgLength)
-					log.Debugf("[IOServer] A. 消息接受完成，老的buf内容为: %v", c.readBuf)
-					c.readBuf = []byte{}
-					log.Debugf("[IOServer] A. 消息接收完成，新的buf内容为: %v", c.readBuf)
-				} else {
-					log.Debugf("[IOServer] msgLength %d", msgLength)
-					log.Debugf("[IOServer] B. 消息接受完成，老的buf内容为: %v", c.readBuf)
-					c.readBuf = c.readBuf[msgLength:len(c.readBuf)]
-					log.Debugf("[IOServer] B. 消息接收完成，新的buf内容为: %v", c.readBuf)
-				}
-				// 生成消息
-				msg := &msg.Msg{
-					Type:     common.GenIntFromType(msgTypeBytes),
-					RawDatas: []byte{},
-					Msg:      nil,
-				}
-
-				c.readTotalBytesLth += msgLength
-				c.readMsgPayloadLth = 0
-				if len(c.readBuf) >= 8 {
-					c.readMsgPayloadLth = common.GenIntFromLength(c.readBuf[0:8])
-					log.Debugf("[IOServer] 读取到足够长度的报文，解析得到的报文长度为 %d, 报文长度元数据: %v, 客户端 %s, buf内容: %v", c.readMsgPayloadLth, c.readBuf[0:8], c.clientId, c.readBuf)
-				}
-				log.Debugf("[IOServer] 当前读取的总长度: %d", c.readTotalBytesLth)
-				return msg, nil
-			} else {
-				// 存在消息体
-				msgPayloadBytes := c.readBuf[12:msgLength]
-				log.Debugf("[IOServer] msgLength %d", msgLength)
-				log.Debugf("[IOServer] C. 消息接收完成，老的buf内容为: %v", c.readBuf)
-				c.readBuf = c.readBuf[msgLength:len(c.readBuf)]
-				log.Debugf("[IOServer] C. 消息接收完成，新的buf内容为: %v", c.readBuf)
-
-				// 生成消息
-				msg := &msg.Msg{
-					Type:     common.GenIntFromType(msgTypeBytes),
-					RawDatas: msgPayloadBytes,
-				}
-
-				c.readTotalBytesLth += msgLength
-				c.readMsgPayloadLth = 0
-				if len(c.readBuf) >= 8 {
-					c.readMsgPayloadLth = common.GenIntFromLength(c.readBuf[0:8])
-					log.Debugf("[IOServer] 读取到足够长度的报文，解析得到的报文长度为 %d, 报文长度元数据: %v, 客户端 %s, buf内容: %v", c.readMsgPayloadLth, c.readBuf[0:8], c.clientId, c.readBuf)
-				}
-				log.Debugf("[IOServer] 当前读取的总长度: %d", c.readTotalBytesLth)
-				return msg, nil
-			}
+	if flags&msg.FRAME_FLAG_GZIP != 0 {
+		payload, err = c.decompressPayload(payload)
+		if err != nil {
+			log.Errorf("[IOServer] 解压 %s 的报文失败，报错内容: %s", c.clientId, err.Error())
+			c.setState(Erroring)
+			return nil, err
 		}
 	}
+	log.Debugf("[IOServer] 从 %s 读取到报文，消息类型 %d, 消息体长度 %d, 当前读取的总长度: %d", c.clientId, msgType, payloadLth, readTotal)
+	return &msg.Msg{
+		Type:     msgType,
+		RawDatas: payload,
+	}, nil
 }
 
-// 向客户端发送消息，不关心响应
-func (c *Client) SendMsg(msg *msg.Msg) {
-	if c.state == Erroring {
+// 向连接写入一个消息，只由写协程调用
+func (c *Client) writeMsg(msg *msg.Msg) error {
+	if c.GetState() == Erroring {
 		log.Warnf("[IOServer] %s 无效，退出发消息循环", c.clientId)
-		return
+		return se.New(fmt.Sprintf("%s 无效，无法发送消息", c.clientId))
 	}
 
-	// 生成MSG
-	protobufMsg := []byte{}
-	var err error
-	if msg.Msg != nil {
-		protobufMsg, err = proto.Marshal(msg.Msg)
-		if err != nil {
-			log.Errorf("[IOServer] protobuf消息生成失败: %s", err.Error())
-			return
-		}
+	// 生成报文，达到阈值时压缩
+	frame, err := encodeFrame(msg)
+	if err != nil {
+		log.Errorf("[IOServer] protobuf消息生成失败: %s", err.Error())
+		return err
 	}
-	// 计算长度等信息
-	msgSize := len(protobufMsg)
-	msgType := msg.Type
-	// 生成结果报文
-	packetBuf := &bytes.Buffer{}
-	lengthBytes := common.GenLengthFromInt(msgSize)
-	packetBuf.Write(lengthBytes[:])
-	typeBytes := common.GenTypeFromInt(int(msgType))
-	packetBuf.Write(typeBytes[:])
-	packetBuf.Write(protobufMsg)
-	packet := packetBuf.Bytes()
-
-	log.Debugf("[IOServer] 发送报文，报文长度 %d，类型 %d，消息体长度 %d", msgSize+12, msgType, msgSize)
-	log.Debugf("[IOServer] 报文内容: %v", packet)
+	frame, flags := c.compressFrame(frame)
+	defer releaseFrame(frame)
+	packet := frame.Bytes()
+	typeBytes := common.GenTypeFromInt(int(c.joinFrameType(msg.Type, flags)))
+	copy(packet[8:12], typeBytes[:])
+	log.Debugf("[IOServer] 向 %s 发送报文，报文长度 %d，类型 %d，报文标记 %#x，消息体长度 %d", c.clientId, len(packet), msg.Type, flags, len(packet)-frameHeaderLth)
 
 	c.sendLock.Lock()
 	// 设置写入超时
@@ -227,7 +209,54 @@ func (c *Client) SendMsg(msg *msg.Msg) {
 	_, err = c.conn.Write(packet)
 	if err != nil {
 		log.Errorf("[IOServer] sendMsg失败: %s", err.Error())
-		c.state = Erroring
+		c.setState(Erroring)
+	} else {
+		atomic.AddUint64(&c.sentTotalBytesLth, uint64(len(packet)))
+		c.countMsg(c.sentMsgCount, msg.Type)
 	}
 	c.sendLock.Unlock()
+	return err
+}
+
+// 登记等待响应的同步请求
+func (c *Client) addPendingCall(requestId uint64, resultCh chan *rpcResult) error {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	if c.pendingClosed {
+		return se.New(fmt.Sprintf("%s 连接已断开，无法发起同步请求", c.clientId))
+	}
+	c.pendingCalls[requestId] = resultCh
+	return nil
+}
+
+// 移除同步请求
+func (c *Client) removePendingCall(requestId uint64) {
+	c.pendingLock.Lock()
+	delete(c.pendingCalls, requestId)
+	c.pendingLock.Unlock()
+}
+
+// 将响应交给等待中的同步请求，请求不存在时返回false
+func (c *Client) resolvePendingCall(requestId uint64, result *rpcResult) bool {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	resultCh, ok := c.pendingCalls[requestId]
+	if !ok {
+		return false
+	}
+	delete(c.pendingCalls, requestId)
+	resultCh <- result
+	return true
+}
+
+// 连接断开时结束所有等待中的同步请求
+func (c *Client) failPendingCalls() {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	c.pendingClosed = true
+	for requestId, resultCh := range c.pendingCalls {
+		log.Warnf("[IOServer] %s 连接断开，同步请求失败, requestId: %d", c.clientId, requestId)
+		resultCh <- &rpcResult{err: se.New(fmt.Sprintf("%s 连接已断开", c.clientId))}
+		delete(c.pendingCalls, requestId)
+	}
 }
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"fmt"
+	cfg "microserver/common/configparse"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+)
+
+/*
+同一个agent重复连接时的处理策略, microserver.ini 中的 common.duplicatepolicy:
+- reject: 保留已有连接，拒绝新连接(默认)
+- replace: 关闭已有连接，使用新连接
+- multiple: 允许同一个agent同时存在多个连接
+*/
+const (
+	DuplicateReject   = "reject"
+	DuplicateReplace  = "replace"
+	DuplicateMultiple = "multiple"
+)
+
+// 获取重复连接的处理策略
+func duplicatePolicy() string {
+	policy := cfg.GlobalConf.GetStr("common", "duplicatepolicy")
+	switch policy {
+	case DuplicateReplace, DuplicateMultiple:
+		return policy
+	case "", DuplicateReject:
+		return DuplicateReject
+	default:
+		log.Warnf("[IOServer] 未知的重复连接策略 %s，使用默认策略 %s", policy, DuplicateReject)
+		return DuplicateReject
+	}
+}
+
+// reject策略下agent已经连接时返回错误，认证阶段用于提前拒绝重复连接
+func (s *IoServer) checkDuplicate(clientId string) error {
+	if duplicatePolicy() != DuplicateReject {
+		return nil
+	}
+	s.clientsLock.RLock()
+	connected := len(s.clients[clientId]) > 0
+	s.clientsLock.RUnlock()
+	if connected {
+		return se.New(fmt.Sprintf("客户端 %s 已经连接", clientId))
+	}
+	return nil
+}
+
+// 将认证通过的客户端加入客户端列表
+func (s *IoServer) registerClient(client *Client) error {
+	replaced := []*Client{}
+
+	s.clientsLock.Lock()
+	if s.stopping() {
+		s.clientsLock.Unlock()
+		return se.New(fmt.Sprintf("服务正在关闭，拒绝客户端 %s", client.clientId))
+	}
+	sessions := s.clients[client.clientId]
+	if len(sessions) > 0 {
+		switch duplicatePolicy() {
+		case DuplicateReject:
+			s.clientsLock.Unlock()
+			log.Warnf("[IOServer] 对端已经连接，因此当前连接被忽略: %s", client.conn.RemoteAddr())
+			return se.New(fmt.Sprintf("客户端 %s 已经连接", client.clientId))
+		case DuplicateReplace:
+			replaced = sessions
+			sessions = nil
+		case DuplicateMultiple:
+			log.Infof("[IOServer] 客户端 %s 新增连接 %s，当前连接数 %d", client.clientId, client.conn.RemoteAddr(), len(sessions)+1)
+		}
+	}
+	s.clients[client.clientId] = append(sessions, client)
+	s.clientsLock.Unlock()
+
+	// 被替换的连接已经不在客户端列表中，读协程退出时不会再通知断开，这里通知订阅者
+	for _, old := range replaced {
+		log.Warnf("[IOServer] 客户端 %s 重新连接，关闭旧连接 %s，使用新连接 %s", client.clientId, old.conn.RemoteAddr(), client.conn.RemoteAddr())
+		old.setState(Erroring)
+		old.Close()
+		s.hooks.emitDisconnect(old)
+	}
+	return nil
+}
+
+// 从客户端列表移除指定的连接，返回是否移除
+func (s *IoServer) removeClient(client *Client) bool {
+	s.clientsLock.Lock()
+	defer s.clientsLock.Unlock()
+
+	sessions := s.clients[client.clientId]
+	for idx, c := range sessions {
+		if c != client {
+			continue
+		}
+		sessions = append(sessions[:idx:idx], sessions[idx+1:]...)
+		if len(sessions) == 0 {
+			delete(s.clients, client.clientId)
+		} else {
+			s.clients[client.clientId] = sessions
+		}
+		return true
+	}
+	return false
+}
+
+// 获取客户端，存在多个连接时返回最新的连接
+func (s *IoServer) getClient(clientId string) (*Client, bool) {
+	s.clientsLock.RLock()
+	defer s.clientsLock.RUnlock()
+	sessions := s.clients[clientId]
+	if len(sessions) == 0 {
+		return nil, false
+	}
+	return sessions[len(sessions)-1], true
+}
+
+// 获取所有连接
+func (s *IoServer) allClients() []*Client {
+	s.clientsLock.RLock()
+	defer s.clientsLock.RUnlock()
+	clients := []*Client{}
+	for _, sessions := range s.clients {
+		clients = append(clients, sessions...)
+	}
+	return clients
+}
+
+// 获取每个agent最新的连接
+func (s *IoServer) agentClients() []*Client {
+	s.clientsLock.RLock()
+	defer s.clientsLock.RUnlock()
+	clients := []*Client{}
+	for _, sessions := range s.clients {
+		if len(sessions) > 0 {
+			clients = append(clients, sessions[len(sessions)-1])
+		}
+	}
+	return clients
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"github.com/golang/protobuf/proto"
+	"microserver/msg"
+	"testing"
+)
+
+func TestRegisterClientReject(t *testing.T) {
+	setTestConf(t, "duplicatepolicy = reject\n")
+	s := newTestServer()
+	oldClient, _ := newTestClient(t, "agent-1")
+	newClient, _ := newTestClient(t, "agent-1")
+
+	if err := s.registerClient(oldClient); err != nil {
+		t.Fatalf("注册第一个连接失败: %v", err)
+	}
+	if err := s.registerClient(newClient); err == nil {
+		t.Fatal("reject策略下重复连接应该返回错误")
+	}
+
+	if got, _ := s.getClient("agent-1"); got != oldClient {
+		t.Error("reject策略下应该保留已有连接")
+	}
+	if len(s.allClients()) != 1 {
+		t.Errorf("连接数为 %d，期望 1", len(s.allClients()))
+	}
+	if clientClosed(oldClient) {
+		t.Error("reject策略下已有连接不应该被关闭")
+	}
+}
+
+func TestRegisterClientReplace(t *testing.T) {
+	setTestConf(t, "duplicatepolicy = replace\n")
+	s := newTestServer()
+	oldClient, _ := newTestClient(t, "agent-1")
+	newClient, _ := newTestClient(t, "agent-1")
+
+	if err := s.registerClient(oldClient); err != nil {
+		t.Fatalf("注册第一个连接失败: %v", err)
+	}
+	if err := s.registerClient(newClient); err != nil {
+		t.Fatalf("replace策略下注册新连接失败: %v", err)
+	}
+
+	if got, _ := s.getClient("agent-1"); got != newClient {
+		t.Error("replace策略下应该使用新连接")
+	}
+	if len(s.allClients()) != 1 {
+		t.Errorf("连接数为 %d，期望 1", len(s.allClients()))
+	}
+	if !clientClosed(oldClient) || oldClient.GetState() != Erroring {
+		t.Error("replace策略下旧连接应该被关闭")
+	}
+	if clientClosed(newClient) {
+		t.Error("replace策略下新连接不应该被关闭")
+	}
+	// 旧连接的读协程退出时不应该移除新连接
+	if s.removeClient(oldClient) {
+		t.Error("旧连接已经被替换，不应该再被移除")
+	}
+	if got, _ := s.getClient("agent-1"); got != newClient {
+		t.Error("旧连接退出后新连接应该保留")
+	}
+}
+
+func TestRegisterClientMultiple(t *testing.T) {
+	setTestConf(t, "duplicatepolicy = multiple\n")
+	s := newTestServer()
+	oldClient, _ := newTestClient(t, "agent-1")
+	newClient, _ := newTestClient(t, "agent-1")
+
+	if err := s.registerClient(oldClient); err != nil {
+		t.Fatalf("注册第一个连接失败: %v", err)
+	}
+	if err := s.registerClient(newClient); err != nil {
+		t.Fatalf("multiple策略下注册新连接失败: %v", err)
+	}
+
+	if got, _ := s.getClient("agent-1"); got != newClient {
+		t.Error("multiple策略下getClient应该返回最新的连接")
+	}
+	if len(s.allClients()) != 2 {
+		t.Errorf("连接数为 %d，期望 2", len(s.allClients()))
+	}
+	if clientClosed(oldClient) || clientClosed(newClient) {
+		t.Error("multiple策略下不应该关闭任何连接")
+	}
+
+	// 移除最新的连接后getClient返回剩余的连接
+	if !s.removeClient(newClient) {
+		t.Fatal("移除新连接失败")
+	}
+	if got, _ := s.getClient("agent-1"); got != oldClient {
+		t.Error("移除最新的连接后getClient应该返回剩余的连接")
+	}
+}
+
+// reject策略下重复连接在认证阶段被拒绝，agent收到带有duplicate原因的失败响应
+func TestRejectDuplicateBeforeAuthResponse(t *testing.T) {
+	setTestConf(t, "duplicatepolicy = reject\nwriteimeout = 5\n")
+	s := newTestServer()
+	oldClient, _ := newTestClient(t, "agent-1")
+	if err := s.registerClient(oldClient); err != nil {
+		t.Fatalf("注册第一个连接失败: %v", err)
+	}
+	if err := s.checkDuplicate("agent-2"); err != nil {
+		t.Errorf("没有连接的agent不应该被拒绝: %v", err)
+	}
+	err := s.checkDuplicate("agent-1")
+	if err == nil {
+		t.Fatal("reject策略下已经连接的agent应该被拒绝")
+	}
+
+	newClient, agentConn := newTestClient(t, "agent-1")
+	go s.sendAuthResponse(newClient, err, authReasonDuplicate, nil)
+	reader := newFrameReader(agentConn)
+	payloadLth, msgType, err := reader.readHeader()
+	if err != nil {
+		t.Fatalf("读取认证响应失败: %v", err)
+	}
+	if msgType != msg.SERVER_MSG_AUTH_RESPONSE {
+		t.Fatalf("响应类型为 %d，期望 %d", msgType, msg.SERVER_MSG_AUTH_RESPONSE)
+	}
+	payload, err := reader.readPayload(payloadLth)
+	if err != nil {
+		t.Fatalf("读取认证响应失败: %v", err)
+	}
+	resp := &msg.AuthResponse{}
+	if err := proto.Unmarshal(payload, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success || resp.Reason != authReasonDuplicate {
+		t.Errorf("认证响应为 %+v，期望失败且原因为 %s", resp, authReasonDuplicate)
+	}
+}
+
+func TestCheckDuplicateOtherPolicies(t *testing.T) {
+	for _, policy := range []string{DuplicateReplace, DuplicateMultiple} {
+		setTestConf(t, "duplicatepolicy = "+policy+"\n")
+		s := newTestServer()
+		client, _ := newTestClient(t, "agent-1")
+		if err := s.registerClient(client); err != nil {
+			t.Fatalf("注册连接失败: %v", err)
+		}
+		if err := s.checkDuplicate("agent-1"); err != nil {
+			t.Errorf("%s 策略下认证阶段不应该拒绝重复连接: %v", policy, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"io/ioutil"
+	cfg "microserver/common/configparse"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"microserver/msg"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	报文压缩，协商了 gzip 能力之后生效
+	- 消息体长度达到 common.compressthreshold (默认1024字节) 时压缩，压缩后没有变小则发送原文
+	- 压缩后的报文在报文标记中设置 FRAME_FLAG_GZIP
+	- common.disablecompress 为true时服务端不提供压缩能力
+*/
+
+// 默认的压缩阈值，单位字节
+const defaultCompressThreshold = 1024
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(ioutil.Discard)
+	},
+}
+
+// 客户端的压缩统计，单位字节
+type CompressionStats struct {
+	SentRawBytes        uint64 `json:"sentrawbytes"`        // 压缩发送的报文压缩前的消息体长度
+	SentCompressedBytes uint64 `json:"sentcompressedbytes"` // 压缩发送的报文压缩后的消息体长度
+	RecvRawBytes        uint64 `json:"recvrawbytes"`        // 接收的压缩报文解压后的消息体长度
+	RecvCompressedBytes uint64 `json:"recvcompressedbytes"` // 接收的压缩报文的消息体长度
+}
+
+// 服务端提供的能力
+func serverCapabilities() []string {
+	capabilities := []string{msg.CAPABILITY_PING}
+	if !cfg.GlobalConf.GetBool("common", "disablecompress") {
+		capabilities = append(capabilities, msg.CAPABILITY_GZIP)
+	}
+	return capabilities
+}
+
+// 获取压缩阈值
+func compressThreshold() int {
+	threshold := cfg.GlobalConf.GetInt("common", "compressthreshold")
+	if threshold <= 0 {
+		return defaultCompressThreshold
+	}
+	return threshold
+}
+
+// 消息体达到阈值时压缩报文，返回发送使用的报文和报文标记
+// 压缩成功时原报文会被放回缓存池
+func (c *Client) compressFrame(frame *proto.Buffer) (*proto.Buffer, uint32) {
+	packet := frame.Bytes()
+	payload := packet[frameHeaderLth:]
+	if !c.HasCapability(msg.CAPABILITY_GZIP) || len(payload) < c.compressThreshold {
+		return frame, 0
+	}
+
+	compressed := frameBufferPool.Get().(*proto.Buffer)
+	buf := bytes.NewBuffer(append(compressed.Bytes()[:0], packet[:frameHeaderLth]...))
+	zw := gzipWriterPool.Get().(*gzip.Writer)
+	zw.Reset(buf)
+	_, err := zw.Write(payload)
+	if err == nil {
+		err = zw.Close()
+	}
+	gzipWriterPool.Put(zw)
+	if err != nil {
+		log.Errorf("[IOServer] 压缩发往 %s 的报文失败，发送原文: %s", c.clientId, err.Error())
+		releaseFrame(compressed)
+		return frame, 0
+	}
+	if buf.Len()-frameHeaderLth >= len(payload) {
+		compressed.SetBuf(buf.Bytes())
+		releaseFrame(compressed)
+		return frame, 0
+	}
+
+	compressed.SetBuf(buf.Bytes())
+	atomic.AddUint64(&c.compression.SentRawBytes, uint64(len(payload)))
+	atomic.AddUint64(&c.compression.SentCompressedBytes, uint64(buf.Len()-frameHeaderLth))
+	releaseFrame(frame)
+	return compressed, msg.FRAME_FLAG_GZIP
+}
+
+// 解压消息体，解压后的长度同样受最大消息体长度的限制
+func (c *Client) decompressPayload(payload []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		c.addMalformedPayload()
+		return nil, err
+	}
+	defer zr.Close()
+
+	raw, err := ioutil.ReadAll(io.LimitReader(zr, int64(c.maxPayloadSize)+1))
+	if err != nil {
+		c.addMalformedPayload()
+		return nil, err
+	}
+	if uint64(len(raw)) > c.maxPayloadSize {
+		atomic.AddUint64(&c.violations.OversizeFrames, 1)
+		log.Errorf("[IOServer] %s 的报文解压后超过最大长度 %d，断开连接", c.clientId, c.maxPayloadSize)
+		return nil, se.New(fmt.Sprintf("%s 的报文解压后超过最大长度 %d", c.clientId, c.maxPayloadSize))
+	}
+
+	atomic.AddUint64(&c.compression.RecvRawBytes, uint64(len(raw)))
+	atomic.AddUint64(&c.compression.RecvCompressedBytes, uint64(len(payload)))
+	return raw, nil
+}
+
+// 获取压缩统计
+func (c *Client) GetCompressionStats() CompressionStats {
+	return CompressionStats{
+		SentRawBytes:        atomic.LoadUint64(&c.compression.SentRawBytes),
+		SentCompressedBytes: atomic.LoadUint64(&c.compression.SentCompressedBytes),
+		RecvRawBytes:        atomic.LoadUint64(&c.compression.RecvRawBytes),
+		RecvCompressedBytes: atomic.LoadUint64(&c.compression.RecvCompressedBytes),
+	}
+}
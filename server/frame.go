@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bufio"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"microserver/common"
+	"microserver/msg"
+	"sync"
+)
+
+/*
+	报文格式: 8字节消息体长度 + 4字节消息类型 + protobuf消息体
+	- 读: bufio.Reader + io.ReadFull，按报文头给出的长度一次性分配消息体
+	- 写: 复用proto.Buffer，报文头和消息体在同一块内存中生成，一次写入
+*/
+
+const (
+	frameHeaderLth  = 12
+	frameReadBufLth = 4096
+	// 超过该大小的写缓存不放回缓存池，避免偶发的大报文长期占用内存
+	frameMaxPooledLth = 64 * 1024
+)
+
+var frameHeaderPlaceholder [frameHeaderLth]byte
+
+var frameBufferPool = sync.Pool{
+	New: func() interface{} {
+		return proto.NewBuffer(make([]byte, 0, 512))
+	},
+}
+
+type frameReader struct {
+	r      *bufio.Reader
+	header [frameHeaderLth]byte
+}
+
+func newFrameReader(r io.Reader) *frameReader {
+	return &frameReader{r: bufio.NewReaderSize(r, frameReadBufLth)}
+}
+
+// 读取报文头，返回消息体长度和消息类型
+func (f *frameReader) readHeader() (uint64, uint64, error) {
+	if _, err := io.ReadFull(f.r, f.header[:]); err != nil {
+		return 0, 0, err
+	}
+	return common.GenIntFromLength(f.header[0:8]), common.GenIntFromType(f.header[8:12]), nil
+}
+
+// 读取指定长度的消息体
+func (f *frameReader) readPayload(payloadLth uint64) ([]byte, error) {
+	payload := make([]byte, payloadLth)
+	if payloadLth == 0 {
+		return payload, nil
+	}
+	if _, err := io.ReadFull(f.r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// 生成完整报文，使用完后需要调用 releaseFrame 放回缓存池
+// agentMsg.Msg 为nil时使用 RawDatas 作为消息体，用于发送已经序列化的消息
+func encodeFrame(agentMsg *msg.Msg) (*proto.Buffer, error) {
+	pb := frameBufferPool.Get().(*proto.Buffer)
+	pb.SetBuf(append(pb.Bytes()[:0], frameHeaderPlaceholder[:]...))
+	if agentMsg.Msg != nil {
+		if err := pb.Marshal(agentMsg.Msg); err != nil {
+			releaseFrame(pb)
+			return nil, err
+		}
+	} else if len(agentMsg.RawDatas) > 0 {
+		pb.SetBuf(append(pb.Bytes(), agentMsg.RawDatas...))
+	}
+
+	packet := pb.Bytes()
+	lengthBytes := common.GenLengthFromInt(len(packet) - frameHeaderLth)
+	copy(packet[0:8], lengthBytes[:])
+	typeBytes := common.GenTypeFromInt(int(agentMsg.Type))
+	copy(packet[8:12], typeBytes[:])
+	return pb, nil
+}
+
+// 将报文缓存放回缓存池
+func releaseFrame(pb *proto.Buffer) {
+	if cap(pb.Bytes()) > frameMaxPooledLth {
+		return
+	}
+	frameBufferPool.Put(pb)
+}
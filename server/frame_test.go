@@ -0,0 +1,237 @@
+package server
+
+import (
+	"bytes"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"microserver/common"
+	"microserver/msg"
+	"testing"
+)
+
+// 重写之前按512/256字节分块读取并拼接缓存的解码方式，用于性能对比
+type chunkedDecoder struct {
+	r          io.Reader
+	readBuf    []byte
+	payloadLth uint64
+}
+
+func (d *chunkedDecoder) getMsg() (*msg.Msg, error) {
+	for {
+		if len(d.readBuf) < 8 {
+			buf := make([]byte, 512)
+			n, err := d.r.Read(buf)
+			if err != nil {
+				return nil, err
+			}
+			d.readBuf = append(d.readBuf, buf[:n]...)
+			if len(d.readBuf) >= 8 {
+				d.payloadLth = common.GenIntFromLength(d.readBuf[0:8])
+			}
+		} else if d.payloadLth+frameHeaderLth > uint64(len(d.readBuf)) {
+			buf := make([]byte, 256)
+			n, err := d.r.Read(buf)
+			if err != nil {
+				return nil, err
+			}
+			d.readBuf = append(d.readBuf, buf[:n]...)
+		} else {
+			msgLength := frameHeaderLth + d.payloadLth
+			agentMsg := &msg.Msg{
+				Type:     common.GenIntFromType(d.readBuf[8:12]),
+				RawDatas: d.readBuf[frameHeaderLth:msgLength],
+			}
+			d.readBuf = d.readBuf[msgLength:]
+			d.payloadLth = 0
+			if len(d.readBuf) >= 8 {
+				d.payloadLth = common.GenIntFromLength(d.readBuf[0:8])
+			}
+			return agentMsg, nil
+		}
+	}
+}
+
+// 重写之前使用bytes.Buffer拼接报文的编码方式，用于性能对比
+func chunkedEncode(agentMsg *msg.Msg) ([]byte, error) {
+	payload := []byte{}
+	if agentMsg.Msg != nil {
+		var err error
+		payload, err = proto.Marshal(agentMsg.Msg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	packetBuf := &bytes.Buffer{}
+	lengthBytes := common.GenLengthFromInt(len(payload))
+	packetBuf.Write(lengthBytes[:])
+	typeBytes := common.GenTypeFromInt(int(agentMsg.Type))
+	packetBuf.Write(typeBytes[:])
+	packetBuf.Write(payload)
+	return packetBuf.Bytes(), nil
+}
+
+func benchMsg() *msg.Msg {
+	return &msg.Msg{
+		Type: msg.CLIENT_MSG_COLLECT,
+		Msg: &msg.Collect{
+			Uptime:   "10 days",
+			Cpuarch:  "x86_64",
+			Cpunum:   16,
+			Memtotal: "65536000 kB",
+			ColTime:  "2020-01-01 00:00:00",
+		},
+	}
+}
+
+// 生成包含count个报文的字节流
+func benchStream(b *testing.B, count int) []byte {
+	frame, err := encodeFrame(benchMsg())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer releaseFrame(frame)
+	return bytes.Repeat(frame.Bytes(), count)
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	msgs := []*msg.Msg{
+		{Type: msg.CLIENT_MSG_HEARTBEAT},
+		{Type: msg.CLIENT_MSG_HEARTBEAT, Msg: &msg.Heartbeat{Status: "ok", HeartbeatTime: "2020-01-01 00:00:00"}},
+		{Type: msg.CLIENT_MSG_RPMS, RawDatas: []byte{}},
+		benchMsg(),
+		{Type: msg.CLIENT_MSG_RPMS, Msg: &msg.Rpms{Rpmlist: []string{"bash", "glibc"}}},
+	}
+
+	stream := []byte{}
+	expected := [][]byte{}
+	for _, m := range msgs {
+		frame, err := encodeFrame(m)
+		if err != nil {
+			t.Fatalf("encodeFrame(%d) 失败: %v", m.Type, err)
+		}
+		stream = append(stream, frame.Bytes()...)
+		expected = append(expected, append([]byte{}, frame.Bytes()[frameHeaderLth:]...))
+		releaseFrame(frame)
+	}
+
+	// bytes.Reader一次Read返回全部数据，多个报文在同一次读取中到达
+	reader := newFrameReader(bytes.NewReader(stream))
+	for idx, m := range msgs {
+		payloadLth, msgType, err := reader.readHeader()
+		if err != nil {
+			t.Fatalf("第 %d 个报文读取报文头失败: %v", idx, err)
+		}
+		if msgType != m.Type {
+			t.Errorf("第 %d 个报文类型为 %d，期望 %d", idx, msgType, m.Type)
+		}
+		if payloadLth != uint64(len(expected[idx])) {
+			t.Fatalf("第 %d 个报文长度为 %d，期望 %d", idx, payloadLth, len(expected[idx]))
+		}
+		payload, err := reader.readPayload(payloadLth)
+		if err != nil {
+			t.Fatalf("第 %d 个报文读取消息体失败: %v", idx, err)
+		}
+		if !bytes.Equal(payload, expected[idx]) {
+			t.Errorf("第 %d 个报文消息体为 %v，期望 %v", idx, payload, expected[idx])
+		}
+		if m.Msg != nil {
+			decoded := proto.Clone(m.Msg)
+			decoded.Reset()
+			if err := proto.Unmarshal(payload, decoded); err != nil {
+				t.Fatalf("第 %d 个报文解析失败: %v", idx, err)
+			}
+			if !proto.Equal(decoded, m.Msg) {
+				t.Errorf("第 %d 个报文解析结果为 %v，期望 %v", idx, decoded, m.Msg)
+			}
+		}
+	}
+	if _, _, err := reader.readHeader(); err != io.EOF {
+		t.Errorf("读取完所有报文后返回 %v，期望 io.EOF", err)
+	}
+}
+
+func TestFrameRawPayload(t *testing.T) {
+	raw, err := proto.Marshal(&msg.Heartbeat{Status: "ok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromProto, err := encodeFrame(&msg.Msg{Type: msg.CLIENT_MSG_HEARTBEAT, Msg: &msg.Heartbeat{Status: "ok"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseFrame(fromProto)
+	fromRaw, err := encodeFrame(&msg.Msg{Type: msg.CLIENT_MSG_HEARTBEAT, RawDatas: raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseFrame(fromRaw)
+	if !bytes.Equal(fromProto.Bytes(), fromRaw.Bytes()) {
+		t.Errorf("RawDatas生成的报文 %v 与protobuf生成的报文 %v 不一致", fromRaw.Bytes(), fromProto.Bytes())
+	}
+}
+
+func BenchmarkGetMsg(b *testing.B) {
+	const framesPerStream = 64
+	stream := benchStream(b, framesPerStream)
+
+	b.Run("frameReader", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(stream) / framesPerStream))
+		r := bytes.NewReader(stream)
+		reader := newFrameReader(r)
+		for i := 0; i < b.N; i++ {
+			if i%framesPerStream == 0 {
+				r.Reset(stream)
+				reader.r.Reset(r)
+			}
+			payloadLth, _, err := reader.readHeader()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := reader.readPayload(payloadLth); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("chunked", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(stream) / framesPerStream))
+		r := bytes.NewReader(stream)
+		decoder := &chunkedDecoder{r: r}
+		for i := 0; i < b.N; i++ {
+			if i%framesPerStream == 0 {
+				r.Reset(stream)
+				decoder.readBuf = nil
+				decoder.payloadLth = 0
+			}
+			if _, err := decoder.getMsg(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkEncodeFrame(b *testing.B) {
+	agentMsg := benchMsg()
+
+	b.Run("encodeFrame", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			frame, err := encodeFrame(agentMsg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			releaseFrame(frame)
+		}
+	})
+
+	b.Run("chunked", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := chunkedEncode(agentMsg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"microserver/msg"
+	"reflect"
+	"runtime"
+	"sync"
+)
+
+// 消息处理函数，agentMsg.Msg 为按注册类型解析后的protobuf报文
+type MsgHandler func(client *Client, agentMsg *msg.Msg)
+
+type msgHandlerEntry struct {
+	protoType reflect.Type // 消息体的protobuf类型，为nil表示无消息体
+	handler   MsgHandler   // 处理函数
+}
+
+type msgHandlerRegistry struct {
+	lock           *sync.RWMutex
+	handlers       map[uint64]*msgHandlerEntry
+	defaultHandler MsgHandler
+	customDefault  bool // 是否设置了自定义的默认处理，设置后未知类型的消息交给默认处理
+}
+
+func newMsgHandlerRegistry() *msgHandlerRegistry {
+	return &msgHandlerRegistry{
+		lock:           &sync.RWMutex{},
+		handlers:       map[uint64]*msgHandlerEntry{},
+		defaultHandler: unknownMsgHandler,
+		customDefault:  false,
+	}
+}
+
+// 注册消息处理函数，protoMsg 为消息体类型的实例(如 &msg.Collect{})，无消息体时传nil
+func (s *IoServer) RegistMsgHandler(msgType uint64, protoMsg proto.Message, handler MsgHandler) error {
+	if handler == nil {
+		return se.New(fmt.Sprintf("消息类型 %d 的处理函数为空", msgType))
+	}
+
+	var protoType reflect.Type
+	if protoMsg != nil {
+		protoType = reflect.TypeOf(protoMsg)
+		if protoType.Kind() != reflect.Ptr {
+			return se.New(fmt.Sprintf("消息类型 %d 的protobuf类型 %v 必须为指针", msgType, protoType))
+		}
+	}
+
+	r := s.msgHandlers
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.handlers[msgType]; ok {
+		log.Errorf("[IOServer] 消息类型 %d 重复注册", msgType)
+		return se.New(fmt.Sprintf("消息类型 %d 已经注册过处理函数", msgType))
+	}
+	r.handlers[msgType] = &msgHandlerEntry{
+		protoType: protoType,
+		handler:   handler,
+	}
+	log.Infof("[IOServer] 消息处理注册, type: %d, proto: %v, handle: %v", msgType, protoType, runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name())
+	return nil
+}
+
+// 设置未知消息类型的处理函数
+func (s *IoServer) SetDefaultMsgHandler(handler MsgHandler) {
+	r := s.msgHandlers
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.customDefault = handler != nil
+	if handler == nil {
+		handler = unknownMsgHandler
+	}
+	r.defaultHandler = handler
+}
+
+// 消息类型是否可以被处理，没有自定义默认处理时未注册的消息类型视为协议违规
+func (r *msgHandlerRegistry) known(msgType uint64) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if r.customDefault {
+		return true
+	}
+	_, ok := r.handlers[msgType]
+	return ok
+}
+
+// 查找消息类型对应的处理函数
+func (r *msgHandlerRegistry) get(msgType uint64) (*msgHandlerEntry, MsgHandler) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.handlers[msgType], r.defaultHandler
+}
+
+// 按注册的protobuf类型解析消息体
+func (e *msgHandlerEntry) decode(agentMsg *msg.Msg) error {
+	if e.protoType == nil {
+		return nil
+	}
+	protoMsg := reflect.New(e.protoType.Elem()).Interface().(proto.Message)
+	if err := proto.Unmarshal(agentMsg.RawDatas, protoMsg); err != nil {
+		return err
+	}
+	agentMsg.Msg = protoMsg
+	return nil
+}
+
+// 默认的未知消息处理
+func unknownMsgHandler(client *Client, agentMsg *msg.Msg) {
+	log.Errorf("[IOServer] 未知的消息类型, %s: %d", client.clientId, agentMsg.Type)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"io/ioutil"
+	cfg "microserver/common/configparse"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// 使用指定内容的配置文件初始化全局配置，测试结束后恢复为空配置
+func setTestConf(t *testing.T, content string) {
+	dir, err := ioutil.TempDir("", "microserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "microserver.ini")
+	if err := ioutil.WriteFile(filename, []byte("[common]\n"+content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.GlobalConf.CfgInit(filename)
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+		emptyFile := filepath.Join(os.TempDir(), "microserver-empty.ini")
+		ioutil.WriteFile(emptyFile, []byte("[common]\n"), 0644)
+		cfg.GlobalConf.CfgInit(emptyFile)
+		os.Remove(emptyFile)
+	})
+}
+
+// 生成只包含客户端列表和生命周期订阅的IoServer
+func newTestServer() *IoServer {
+	return &IoServer{
+		clientsLock: &sync.RWMutex{},
+		clients:     map[string][]*Client{},
+		stopCh:      make(chan struct{}),
+		hooks:       newLifecycleHooks(),
+	}
+}
+
+// 生成使用内存连接的客户端，返回客户端和对端连接
+func newTestClient(t *testing.T, clientId string) (*Client, net.Conn) {
+	serverConn, agentConn := net.Pipe()
+	client := NewClient(serverConn, "127.0.0.1")
+	client.clientId = clientId
+	t.Cleanup(func() {
+		client.Close()
+		agentConn.Close()
+	})
+	return client, agentConn
+}
+
+func clientClosed(c *Client) bool {
+	select {
+	case <-c.closeCh:
+		return true
+	default:
+		return false
+	}
+}
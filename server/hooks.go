@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	log "microserver/common/formatlog"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	连接生命周期订阅，插件可以在客户端注册、状态变化、移除时得到通知
+	每个订阅者拥有独立的事件队列和协程，按事件发生的顺序依次调用，回调中的panic会被记录并忽略
+	一个订阅者处理缓慢只会影响自己，不会阻塞客户端的注册和断开，也不会影响其它订阅者
+	订阅者的事件队列满时丢弃该订阅者的事件并计数，可以通过 GetDroppedHookEvents 查看
+*/
+
+type ConnectHook func(client *Client)
+type DisconnectHook func(client *Client)
+type StateChangeHook func(client *Client, oldState int, newState int)
+
+// 每个订阅者等待调用的事件数量上限
+const hookEventQueueSize = 1024
+
+type hookEvent struct {
+	client   *Client
+	kind     string
+	oldState int
+	newState int
+}
+
+// 订阅者，只接收订阅的事件类型
+type hookSubscriber struct {
+	kind   string
+	hook   interface{}
+	call   func(event *hookEvent)
+	events chan *hookEvent
+}
+
+type lifecycleHooks struct {
+	lock        *sync.RWMutex
+	subscribers []*hookSubscriber
+	queueSize   int    // 每个订阅者的事件队列长度
+	dropped     uint64 // 因为订阅者的队列满被丢弃的事件数
+}
+
+func newLifecycleHooks() *lifecycleHooks {
+	return &lifecycleHooks{
+		lock:      &sync.RWMutex{},
+		queueSize: hookEventQueueSize,
+	}
+}
+
+// 添加订阅者并启动订阅者的协程
+func (h *lifecycleHooks) subscribe(kind string, hook interface{}, call func(event *hookEvent)) {
+	sub := &hookSubscriber{
+		kind:   kind,
+		hook:   hook,
+		call:   call,
+		events: make(chan *hookEvent, h.queueSize),
+	}
+	h.lock.Lock()
+	h.subscribers = append(h.subscribers, sub)
+	h.lock.Unlock()
+	go sub.run()
+}
+
+func (sub *hookSubscriber) run() {
+	for event := range sub.events {
+		safeCall(sub.hook, func() { sub.call(event) })
+	}
+}
+
+// 订阅客户端注册事件
+func (s *IoServer) OnConnect(hook ConnectHook) {
+	s.hooks.subscribe("connect", hook, func(event *hookEvent) { hook(event.client) })
+	log.Infof("[IOServer] 订阅连接事件, hook: %v", hookName(hook))
+}
+
+// 订阅客户端移除事件
+func (s *IoServer) OnDisconnect(hook DisconnectHook) {
+	s.hooks.subscribe("disconnect", hook, func(event *hookEvent) { hook(event.client) })
+	log.Infof("[IOServer] 订阅断开事件, hook: %v", hookName(hook))
+}
+
+// 订阅客户端状态变化事件
+func (s *IoServer) OnStateChange(hook StateChangeHook) {
+	s.hooks.subscribe("statechange", hook, func(event *hookEvent) { hook(event.client, event.oldState, event.newState) })
+	log.Infof("[IOServer] 订阅状态变化事件, hook: %v", hookName(hook))
+}
+
+// 将事件交给订阅了该事件的订阅者，订阅者的队列满时丢弃并计数，不会阻塞调用方
+func (h *lifecycleHooks) emit(event *hookEvent) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	for _, sub := range h.subscribers {
+		if sub.kind != event.kind {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			atomic.AddUint64(&h.dropped, 1)
+			log.Errorf("[IOServer] 生命周期回调 %s 的事件队列已满，丢弃 %s 的 %s 事件", hookName(sub.hook), event.client.clientId, event.kind)
+		}
+	}
+}
+
+func (h *lifecycleHooks) emitConnect(client *Client) {
+	h.emit(&hookEvent{client: client, kind: "connect"})
+}
+
+func (h *lifecycleHooks) emitDisconnect(client *Client) {
+	h.emit(&hookEvent{client: client, kind: "disconnect"})
+}
+
+func (h *lifecycleHooks) emitStateChange(client *Client, oldState int, newState int) {
+	h.emit(&hookEvent{client: client, kind: "statechange", oldState: oldState, newState: newState})
+}
+
+// 获取因为订阅者的队列满被丢弃的生命周期事件数
+func (s *IoServer) GetDroppedHookEvents() uint64 {
+	return atomic.LoadUint64(&s.hooks.dropped)
+}
+
+// 调用回调，记录并忽略panic
+func safeCall(hook interface{}, call func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("[IOServer] 生命周期回调 %s 异常: %v", hookName(hook), r)
+		}
+	}()
+	call()
+}
+
+func hookName(hook interface{}) string {
+	v := reflect.ValueOf(hook)
+	if v.Kind() != reflect.Func {
+		return fmt.Sprintf("%v", hook)
+	}
+	return runtime.FuncForPC(v.Pointer()).Name()
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// 被替换的连接需要通知断开，订阅者看到的连接和断开事件成对出现
+func TestReplacedClientEmitsDisconnect(t *testing.T) {
+	setTestConf(t, "duplicatepolicy = replace\n")
+	s := newTestServer()
+	disconnected := make(chan *Client, 2)
+	s.OnDisconnect(func(client *Client) {
+		disconnected <- client
+	})
+
+	oldClient, _ := newTestClient(t, "agent-1")
+	newClient, _ := newTestClient(t, "agent-1")
+	if err := s.registerClient(oldClient); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.registerClient(newClient); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case c := <-disconnected:
+		if c != oldClient {
+			t.Error("断开事件应该针对被替换的旧连接")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("被替换的连接没有通知断开")
+	}
+	select {
+	case c := <-disconnected:
+		t.Errorf("只应该有一个断开事件，多余的事件: %p", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// 一个订阅者阻塞时不影响注册流程和其它订阅者，队列满时丢弃该订阅者的事件并计数
+func TestSlowHookDoesNotBlock(t *testing.T) {
+	s := newTestServer()
+	// 阻塞的订阅者只有一个队列位置
+	s.hooks.queueSize = 1
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	s.OnConnect(func(client *Client) {
+		started <- struct{}{}
+		<-release
+	})
+	s.hooks.queueSize = hookEventQueueSize
+	connected := make(chan *Client, 3)
+	s.OnConnect(func(client *Client) {
+		connected <- client
+	})
+	client, _ := newTestClient(t, "agent-1")
+
+	done := make(chan struct{})
+	go func() {
+		// 第一个事件阻塞在回调中，第二个事件进入队列，第三个事件被丢弃
+		s.hooks.emitConnect(client)
+		<-started
+		s.hooks.emitConnect(client)
+		s.hooks.emitConnect(client)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("订阅者阻塞时发送事件不应该等待")
+	}
+	for idx := 0; idx < 3; idx++ {
+		select {
+		case <-connected:
+		case <-time.After(time.Second):
+			t.Fatal("一个订阅者阻塞时其它订阅者应该继续收到事件")
+		}
+	}
+	if got := s.GetDroppedHookEvents(); got != 1 {
+		t.Errorf("丢弃的事件数为 %d，期望 1", got)
+	}
+}
@@ -1,16 +1,15 @@
 package server
 
 import (
+	"crypto/tls"
 	"fmt"
-	"github.com/golang/protobuf/proto"
+	"microserver/common"
 	cfg "microserver/common/configparse"
 	se "microserver/common/error"
 	log "microserver/common/formatlog"
 	"microserver/controller"
 	"microserver/msg"
-	"microserver/plugin/collector"
 	"net"
-	"strings"
 	"sync"
 	"time"
 )
@@ -24,30 +23,94 @@ const (
 )
 
 type IoServer struct {
-	clientsLock *sync.RWMutex      // 客户端列表锁
-	clients     map[string]*Client // 客户端列表
+	clientsLock  *sync.RWMutex        // 客户端列表锁
+	clients      map[string][]*Client // 客户端列表，key为agentID，value为该agent的连接
+	msgHandlers  *msgHandlerRegistry  // 消息处理注册表
+	rpcSeq       uint64               // 同步请求的requestId序列
+	listenerLock *sync.Mutex          // 监听锁
+	listeners    []*ioListener        // IO服务监听
+	stopOnce     *sync.Once           // 保证只关闭一次
+	stopCh       chan struct{}        // 服务关闭信号
+	msgWg        *sync.WaitGroup      // 处理中的消息
+	dispatchLock *sync.RWMutex        // 消息登记锁，关闭时用于同步msgWg
+	workers      *workerPool          // 消息处理协程池
+	hooks        *lifecycleHooks      // 连接生命周期订阅
+	globalAccess *accessControl       // 所有监听共同的准入控制
+	access       *accessControl       // WebSocket接入的准入控制
+	outbox       *outbox              // 离线消息发送状态
+	operations   *operationTracker    // 可追踪的广播操作
+	authReplay   *authReplayCache     // 已经使用过的认证签名
 }
 
 // Server初始化
 func (s *IoServer) Init() {
 	log.Infoln("[IOServer] 初始化Agent 对象....")
 	Ioserver = &IoServer{
-		clientsLock: &sync.RWMutex{},
-		clients:     map[string]*Client{},
+		clientsLock:  &sync.RWMutex{},
+		clients:      map[string][]*Client{},
+		msgHandlers:  newMsgHandlerRegistry(),
+		listenerLock: &sync.Mutex{},
+		stopOnce:     &sync.Once{},
+		stopCh:       make(chan struct{}),
+		msgWg:        &sync.WaitGroup{},
+		dispatchLock: &sync.RWMutex{},
+	}
+	Ioserver.workers = newWorkerPool(Ioserver.dispatchMsg)
+	Ioserver.hooks = newLifecycleHooks()
+	Ioserver.outbox = newOutbox()
+	Ioserver.operations = newOperationTracker()
+	Ioserver.authReplay = newAuthReplayCache()
+	globalAccess, err := newAccessControl("access")
+	if err != nil {
+		panic(err)
+	}
+	Ioserver.globalAccess = globalAccess
+	access, err := newAccessControl("websocket")
+	if err != nil {
+		panic(err)
+	}
+	Ioserver.access = access
+
+	// 注册内置的消息处理
+	if err := Ioserver.RegistMsgHandler(msg.CLIENT_MSG_HEARTBEAT, &msg.Heartbeat{}, Ioserver.handleClientHeartbeatMsg); err != nil {
+		panic(err)
+	}
+	if err := Ioserver.RegistMsgHandler(msg.CLIENT_MSG_RPC_RESPONSE, &msg.RpcResponse{}, Ioserver.handleClientRpcResponseMsg); err != nil {
+		panic(err)
+	}
+	if err := Ioserver.RegistMsgHandler(msg.CLIENT_MSG_AUTH, nil, Ioserver.handleClientRepeatedAuthMsg); err != nil {
+		panic(err)
+	}
+	if err := Ioserver.RegistMsgHandler(msg.CLIENT_MSG_PONG, &msg.Ping{}, Ioserver.handleClientPongMsg); err != nil {
+		panic(err)
+	}
+	if err := Ioserver.RegistMsgHandler(msg.CLIENT_MSG_OPERATION_ACK, &msg.OperationAck{}, Ioserver.handleClientOperationAckMsg); err != nil {
+		panic(err)
 	}
 }
 
 func (s *IoServer) backgroundService() {
 	// 启动agent存活检查
 	go s.agentAliveCheck()
+	// 启动连接存活检查，断开超时的客户端
+	go s.livenessSweep()
+	// 启动空闲客户端探测
+	go s.pingLoop()
+	// 启动过期离线消息清理
+	go s.outboxPurgeLoop()
 
-	select {}
+	<-s.stopCh
+	log.Infoln("[IOServer] 后台服务退出")
 }
 
 func (s *IoServer) agentAliveCheck() {
 	for {
 		// 延迟启动，避免误报
-		time.Sleep(time.Duration(5) * time.Second)
+		select {
+		case <-s.stopCh:
+			return
+		case <-time.After(time.Duration(5) * time.Second):
+		}
 
 		curAgents := s.ListAliveAcgents()
 		dbAgents, err := controller.Agentctrl.ListAgents()
@@ -56,19 +119,22 @@ func (s *IoServer) agentAliveCheck() {
 			continue
 		}
 		for _, dbAgent := range dbAgents {
-			dbAgentIp := dbAgent.AgentIp
 			agentState := Erroring
 			for _, curAgent := range curAgents {
-				if dbAgentIp == curAgent {
+				if dbAgent.AgentId == curAgent {
 					agentState = Running
 					break
 				}
 			}
 			if agentState == Erroring {
-				log.Errorf("[IOServer] Agent: %s 状态错误, 请检查", dbAgentIp)
+				log.Errorf("[IOServer] Agent: %s(%s) 状态错误, 请检查", dbAgent.AgentId, dbAgent.AgentIp)
 			}
 		}
-		time.Sleep(time.Duration(20) * time.Second)
+		select {
+		case <-s.stopCh:
+			return
+		case <-time.After(time.Duration(20) * time.Second):
+		}
 	}
 }
 
@@ -77,59 +143,77 @@ func (s *IoServer) Run() {
 	// 启动后台服务
 	go s.backgroundService()
 
-	l, err := net.Listen("tcp", cfg.GlobalConf.GetStr("common", "svraddr"))
+	listeners, err := listenAll()
 	if err != nil {
 		panic(err)
 	}
-	log.Infof("[IOServer] IO服务启动，监听地址: %s", cfg.GlobalConf.GetStr("common", "svraddr"))
-	defer l.Close()
-
-	for {
-		conn, err := l.Accept()
-
-		if err != nil {
-			log.Errorf("[IOServer] IO服务accept异常: %s", err.Error())
-			continue
-		}
-		log.Debugf("[IOServer] IO服务收到连接请求，对端 -> 本端信息: %s -> %s", conn.RemoteAddr(), conn.LocalAddr())
+	s.serveAll(listeners)
+}
 
-		// 每次都启动一个专门的协程用于检查请求
-		go s.handleConnection(conn)
+// 获取TLS证书中的agent身份，非TLS连接或者没有校验证书时返回空
+func (s *IoServer) getConnCertId(conn net.Conn) (string, error) {
+	// WebSocket接入在升级之前已经从HTTPS请求中获取了证书身份
+	if wc, ok := conn.(*wsConn); ok {
+		return wc.certId, nil
+	}
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return "", nil
 	}
+	return s.getTlsConnId(tlsConn, cfg.GlobalConf.GetInt("common", "readtimeout"))
 }
 
-// 获取连接对端的唯一ID
-func (s *IoServer) getConnId(conn net.Conn) (string, error) {
+// 获取连接对端的IP，支持IPv4和IPv6
+func (s *IoServer) getConnIp(conn net.Conn) (string, error) {
+	if conn.RemoteAddr().Network() == "unix" {
+		return unixConnIp, nil
+	}
 	addr := conn.RemoteAddr().String()
-	addrs := strings.Split(addr, ":")
-	if len(addrs) != 2 {
+	ip, err := common.HostIpFromAddr(addr)
+	if err != nil {
 		log.Errorf("[IOServer] 对端地址信息异常: %s", addr)
 		return "", se.New(fmt.Sprintf("对端地址信息异常: %s", addr))
 	}
-	return strings.TrimSpace(addrs[0]), nil
+	return ip, nil
 }
 
 // 处理连接请求
-func (s *IoServer) handleConnection(conn net.Conn) {
+// 对端IP只作为agent的属性，agent的唯一ID由认证报文声明
+func (s *IoServer) handleConnection(conn net.Conn, agentIp string) {
 	defer conn.Close()
 
-	// 获取对端ID，一般就是对端的IP信息
-	clientId, err := s.getConnId(conn)
+	certId, err := s.getConnCertId(conn)
 	if err != nil {
-		log.Errorf("[IOServer] 获取AgentID错误: %v", err.Error())
+		log.Errorf("[IOServer] 获取Agent证书身份错误: %v", err.Error())
 		return
 	}
 
-	// 判断conn是否是新的client，是的话就新增，否则结束连接，确保每个链接是唯一的
-	s.clientsLock.Lock()
-	if _, ok := s.clients[clientId]; ok {
-		log.Warnf("[IOServer] 对端已经连接，因此当前连接被忽略: %s", conn.RemoteAddr())
-		s.clientsLock.Unlock()
+	// 认证通过之前不会加入客户端列表
+	client := NewClient(conn, agentIp)
+	defer client.Close()
+	client.knownMsgType = s.msgHandlers.known
+	clientId, err := s.authenticate(client, certId)
+	if err != nil {
+		log.Errorf("[IOServer] 客户端 %s 认证失败，关闭连接: %s", agentIp, err.Error())
 		return
 	}
-	client := NewClient(conn, clientId)
-	s.clients[clientId] = client
-	s.clientsLock.Unlock()
+	client.clientId = clientId
+
+	// 加入客户端列表，agent已经连接时按照重复连接策略处理
+	client.stateHook = s.hooks.emitStateChange
+	if err := s.registerClient(client); err != nil {
+		return
+	}
+
+	// 记录agent当前的IP，加入客户端列表之后更新，被拒绝的连接不会覆盖已有连接的IP
+	if err := controller.Agentctrl.UpdateAgentIp(clientId, agentIp); err != nil {
+		log.Errorf("[IOServer] 更新 %s 的IP %s 失败: %s", clientId, agentIp, err.Error())
+	}
+	s.hooks.emitConnect(client)
+	client.setState(Running)
+
+	// 发送agent离线期间积累的消息
+	go s.flushOutbox(clientId)
 
 	// 交互
 	// 当前协程会负责所有的从client的read的请求。
@@ -137,61 +221,66 @@ func (s *IoServer) handleConnection(conn net.Conn) {
 	for {
 		// 完整的读取一个msg
 		log.Debugf("[IOServer] 开始从客户端 %s 读取消息", client.clientId)
-		// 判断下心跳包的超时问题
-		if !client.Valid() {
-			client.state = Erroring
-		}
 		msg, err := client.GetMsg()
 		if err != nil {
-			log.Errorf("[IOServer] 从客户端 %s 获取消息失败，结束与该客户端的连接，报错内容: %s", client.clientId, err.Error())
+			log.Errorf("[IOServer] 从客户端 %s 获取消息失败，结束与该客户端的连接，报错内容: %s, 协议违规计数: %+v", client.clientId, err.Error(), client.GetProtocolViolations())
 			// 从server端移除client
-			s.clientsLock.Lock()
-			client.state = Erroring
-			if _, ok := s.clients[client.clientId]; ok {
+			client.setState(Erroring)
+			if s.removeClient(client) {
 				log.Infof("[IOServer] 移除客户端: %s", client.clientId)
-				delete(s.clients, client.clientId)
+				s.hooks.emitDisconnect(client)
 			}
-			s.clientsLock.Unlock()
+			client.failPendingCalls()
 			break
 		}
-		// 处理消息
-		go s.handleMsg(msg, client)
+		// 超过接收限制的消息按限流策略处理
+		if !client.throttle(msg) {
+			continue
+		}
+		// 同步请求的响应和探测响应直接处理，不排在协程池中
+		if inlineMsgTypes[msg.Type] {
+			s.handleMsg(msg, client)
+			continue
+		}
+		// 处理消息，服务关闭后不再处理新的消息
+		if !s.acquireMsg() {
+			log.Warnf("[IOServer] 服务正在关闭，丢弃客户端 %s 的消息, 消息类型 %d", client.clientId, msg.Type)
+			continue
+		}
+		s.workers.submit(msg, client)
 	}
 }
 
-func (s *IoServer) handleMsg(agentMsg *msg.Msg, client *Client) {
-	switch agentMsg.Type {
-	case msg.CLIENT_MSG_HEARTBEAT:
-		s.handleClientHeartbeatMsg(agentMsg, client)
-	case msg.CLIENT_MSG_COLLECT:
-		collector.HandleCollectData(client.clientId, agentMsg)
-	default:
-		log.Errorf("[IOServer] 未知的消息类型, %s: %d", client.clientId, agentMsg.Type)
-	}
+// 处理协程池调用，处理完成后结束消息登记
+func (s *IoServer) dispatchMsg(agentMsg *msg.Msg, client *Client) {
+	defer s.msgWg.Done()
+	s.handleMsg(agentMsg, client)
 }
 
-func (s *IoServer) handleClientHeartbeatMsg(agentMsg *msg.Msg, client *Client) {
-	heartbeatMsg := &msg.Heartbeat{}
-	if err := proto.Unmarshal(agentMsg.RawDatas, heartbeatMsg); err != nil {
-		log.Errorf("[IOServer] 解析心跳信息失败 %s, 失败原因 %s", client.clientId, err.Error())
+func (s *IoServer) handleMsg(agentMsg *msg.Msg, client *Client) {
+	entry, defaultHandler := s.msgHandlers.get(agentMsg.Type)
+	if entry == nil {
+		defaultHandler(client, agentMsg)
 		return
 	}
+	if err := entry.decode(agentMsg); err != nil {
+		client.addMalformedPayload()
+		log.Errorf("[IOServer] 解析消息失败 %s, 消息类型 %d, 失败原因 %s", client.clientId, agentMsg.Type, err.Error())
+		return
+	}
+	entry.handler(client, agentMsg)
+}
+
+func (s *IoServer) handleClientHeartbeatMsg(client *Client, agentMsg *msg.Msg) {
+	heartbeatMsg := agentMsg.Msg.(*msg.Heartbeat)
 	log.Debugf("[IOServer] 接收到 %s 的心跳请求，心跳包时间 %s，心跳包状态 %s", client.clientId, heartbeatMsg.HeartbeatTime, heartbeatMsg.Status)
 	client.SetLastHeartbeatSyncTime(heartbeatMsg.HeartbeatTime)
-	// 返回响应报文，确保客户端读取不要超时
+	// 返回响应报文，确保客户端读取不要超时，队列满时直接丢弃，不阻塞处理协程
 	heartbeatResponseMsg := &msg.Msg{
 		Type: msg.SERVER_MSG_HEARTBEAT_RESPONSE,
 		Msg:  nil,
 	}
-	client.SendMsg(heartbeatResponseMsg)
-}
-
-func (s *IoServer) broadcast(msg *msg.Msg) {
-	s.clientsLock.Lock()
-	for _, c := range s.clients {
-		go c.SendMsg(msg)
-	}
-	s.clientsLock.Unlock()
+	client.trySendMsg(heartbeatResponseMsg)
 }
 
 func (s *IoServer) ListAliveAcgents() []string {
@@ -204,13 +293,61 @@ func (s *IoServer) ListAliveAcgents() []string {
 	return agents
 }
 
-func (s *IoServer) BroadcastUpdate() {
-	log.Infoln("[IOServer] 服务端开始通知agent进行升级")
+// 通知所有agent进行升级，返回可追踪的操作ID，消息在后台发送
+// 不在线的agent写入离线消息，重新连接后发送
+func (s *IoServer) BroadcastUpdate() string {
+	agentIds := s.broadcastTargets()
+	opId := s.operations.create("update", agentIds)
+	log.Infof("[IOServer] 服务端开始通知agent进行升级, operationId: %s, agent数: %d", opId, len(agentIds))
 	updateMsg := &msg.Msg{
 		Type: msg.SERVER_MSG_AGENT_UPDATE,
 		Msg: &msg.UpdateMsg{
 			Updateswitch: true,
+			OperationId:  opId,
 		},
 	}
-	s.broadcast(updateMsg)
-}
\ No newline at end of file
+	go s.deliverOperation(opId, agentIds, updateMsg)
+	return opId
+}
+
+// 广播的目标agent，包括在线的agent和数据库中登记过的agent
+func (s *IoServer) broadcastTargets() []string {
+	agentIds := s.ListAliveAcgents()
+	agents, err := controller.Agentctrl.ListAgents()
+	if err != nil {
+		log.Errorf("[IOServer] 获取agent列表失败，只通知在线的agent: %s", err.Error())
+		return agentIds
+	}
+	known := map[string]bool{}
+	for _, agentId := range agentIds {
+		known[agentId] = true
+	}
+	for _, agent := range agents {
+		if !known[agent.AgentId] {
+			known[agent.AgentId] = true
+			agentIds = append(agentIds, agent.AgentId)
+		}
+	}
+	return agentIds
+}
+
+// 通知指定的agent进行升级，不在线的agent写入离线消息，返回每个agent的发送结果
+func (s *IoServer) SendUpdate(agentIds []string) []*DeliveryResult {
+	log.Infof("[IOServer] 服务端开始通知agent %v 进行升级", agentIds)
+	updateMsg := &msg.Msg{
+		Type: msg.SERVER_MSG_AGENT_UPDATE,
+		Msg: &msg.UpdateMsg{
+			Updateswitch: true,
+		},
+	}
+	return s.SendOrQueueToAgents(agentIds, updateMsg, 0)
+}
+
+// 获取所有在线agent的探测统计，key为agentID
+func (s *IoServer) ListAgentPingStats() map[string]PingStats {
+	result := map[string]PingStats{}
+	for _, c := range s.agentClients() {
+		result[c.clientId] = c.GetPingStats()
+	}
+	return result
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"microserver/common"
+	"net"
+	"testing"
+)
+
+// 在回环地址上建立连接，检查服务端解析出的对端IP和地址族
+func TestGetConnIpLoopback(t *testing.T) {
+	cases := []struct {
+		network string
+		addr    string
+		ip      string
+		family  string
+	}{
+		{network: "tcp4", addr: "127.0.0.1:0", ip: "127.0.0.1", family: common.IP_FAMILY_V4},
+		{network: "tcp6", addr: "[::1]:0", ip: "::1", family: common.IP_FAMILY_V6},
+	}
+
+	s := &IoServer{}
+	for _, c := range cases {
+		l, err := net.Listen(c.network, c.addr)
+		if err != nil {
+			t.Logf("%s 不可用，跳过: %v", c.network, err)
+			continue
+		}
+
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}()
+
+		client, err := net.Dial(c.network, l.Addr().String())
+		if err != nil {
+			l.Close()
+			t.Fatalf("连接 %s %s 失败: %v", c.network, l.Addr(), err)
+		}
+		conn, ok := <-accepted
+		if !ok {
+			client.Close()
+			l.Close()
+			t.Fatalf("%s accept失败", c.network)
+		}
+
+		ip, err := s.getConnIp(conn)
+		if err != nil {
+			t.Errorf("%s getConnIp 返回错误: %v", c.network, err)
+		} else {
+			if ip != c.ip {
+				t.Errorf("%s getConnIp = %q，期望 %q", c.network, ip, c.ip)
+			}
+			if family := common.IpFamily(ip); family != c.family {
+				t.Errorf("%s 的地址族为 %q，期望 %q", c.network, family, c.family)
+			}
+		}
+		conn.Close()
+		client.Close()
+		l.Close()
+	}
+}
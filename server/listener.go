@@ -0,0 +1,258 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	cfg "microserver/common/configparse"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+/*
+IO服务的监听，所有监听接入的连接加入同一个客户端列表
+- common.listeners: 逗号分隔的监听名称，为空时只有一个名称为default的监听
+每个监听对应配置段 [listener.<名称>]:
+- network: tcp(默认，双栈)、tcp4、tcp6、unix，default监听未配置时使用 common.svrnetwork
+- addr: 监听地址，unix时为socket文件路径，default监听未配置时使用 common.svraddr
+- mode: unix socket文件的权限，八进制，如 0660
+- tls: 是否开启TLS，未配置时使用 [tls] 中的 enable
+- certfile / keyfile / clientcafile / verifyclient: 未配置时使用 [tls] 中的配置
+- allow / deny / maxconns / maxconnsperip: 该监听额外的准入限制，[access] 中的全局限制同时生效
+unix socket接入的连接没有对端IP，agent的IP记为 127.0.0.1
+*/
+
+const (
+	defaultListenerName = "default"
+	unixConnIp          = "127.0.0.1"
+)
+
+type ioListener struct {
+	name    string
+	network string
+	addr    string
+	l       net.Listener
+	access  *accessControl
+}
+
+func confBool(value string) bool {
+	return value == "true" || value == "1"
+}
+
+func listenerSection(name string) string {
+	return "listener." + name
+}
+
+// 获取配置的监听名称
+func listenerNames() []string {
+	names := []string{}
+	for _, name := range strings.Split(cfg.GlobalConf.GetStr("common", "listeners"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = append(names, defaultListenerName)
+	}
+	return names
+}
+
+// 按照配置生成监听，开启TLS时包装为TLS监听
+func newIoListener(name string) (*ioListener, error) {
+	section := listenerSection(name)
+	network := cfg.GlobalConf.GetStr(section, "network")
+	addr := cfg.GlobalConf.GetStr(section, "addr")
+	if name == defaultListenerName {
+		if network == "" {
+			network = cfg.GlobalConf.GetStr("common", "svrnetwork")
+		}
+		if addr == "" {
+			addr = cfg.GlobalConf.GetStr("common", "svraddr")
+		}
+	}
+	if network == "" {
+		network = "tcp"
+	}
+	if addr == "" {
+		return nil, se.New(fmt.Sprintf("监听 %s 没有配置监听地址", name))
+	}
+
+	access, err := newAccessControl(section)
+	if err != nil {
+		return nil, err
+	}
+
+	var l net.Listener
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		l, err = net.Listen(network, addr)
+	case "unix":
+		l, err = listenUnix(section, addr)
+	default:
+		return nil, se.New(fmt.Sprintf("监听 %s 不支持的网络类型: %s", name, network))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tlsEnable := cfg.GlobalConf.GetStr(section, "tls")
+	if tlsEnable == "" {
+		tlsEnable = cfg.GlobalConf.GetStr("tls", "enable")
+	}
+	if confBool(tlsEnable) {
+		tlsConf, err := newTlsConfig(section)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		log.Infof("[IOServer] 监听 %s 开启TLS, 客户端证书校验模式: %v", name, tlsConf.ClientAuth)
+		l = tls.NewListener(l, tlsConf)
+	}
+
+	return &ioListener{
+		name:    name,
+		network: network,
+		addr:    addr,
+		l:       l,
+		access:  access,
+	}, nil
+}
+
+// 监听unix socket，启动前清理上次遗留的socket文件
+// 只有连接socket被拒绝时才认为是遗留的文件，socket仍在使用时返回错误，避免删除正在运行的服务的socket
+func listenUnix(section string, path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		conn, err := net.DialTimeout("unix", path, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil, se.New(fmt.Sprintf("socket文件 %s 正在被其它进程使用", path))
+		}
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, se.New(fmt.Sprintf("检查socket文件 %s 失败: %s", path, err.Error()))
+		}
+		log.Warnf("[IOServer] 清理遗留的socket文件 %s", path)
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode := cfg.GlobalConf.GetStr(section, "mode"); mode != "" {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			l.Close()
+			return nil, se.New(fmt.Sprintf("socket文件权限 %s 不合法", mode))
+		}
+		if err := os.Chmod(path, os.FileMode(perm)); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// 生成所有配置的监听，任意一个失败时关闭已经生成的监听
+func listenAll() ([]*ioListener, error) {
+	listeners := []*ioListener{}
+	for _, name := range listenerNames() {
+		ln, err := newIoListener(name)
+		if err != nil {
+			log.Errorf("[IOServer] 监听 %s 启动失败: %s", name, err.Error())
+			for _, l := range listeners {
+				l.l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// 在一个监听上接受连接，服务关闭后返回
+func (s *IoServer) serve(ln *ioListener) {
+	log.Infof("[IOServer] IO服务启动，监听 %s: %s://%s", ln.name, ln.network, ln.addr)
+	defer ln.l.Close()
+
+	var backoff time.Duration
+	for {
+		conn, err := ln.l.Accept()
+
+		if err != nil {
+			if s.stopping() {
+				log.Infof("[IOServer] 监听 %s 停止接受新连接", ln.name)
+				return
+			}
+			// 连续出错时(如文件描述符耗尽)等待一段时间再重试，避免空转
+			backoff = acceptBackoff(backoff)
+			log.Errorf("[IOServer] 监听 %s accept异常: %s，%s 后重试", ln.name, err.Error(), backoff)
+			select {
+			case <-time.After(backoff):
+			case <-s.stopCh:
+			}
+			continue
+		}
+		backoff = 0
+		log.Debugf("[IOServer] 监听 %s 收到连接请求，对端 -> 本端信息: %s -> %s", ln.name, conn.RemoteAddr(), conn.LocalAddr())
+
+		// 创建Client之前检查访问规则和连接数限制
+		agentIp, err := s.getConnIp(conn)
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		if !s.admitConn(ln.access, conn.RemoteAddr().String(), agentIp) {
+			conn.Close()
+			continue
+		}
+
+		// 每次都启动一个专门的协程用于检查请求
+		go func() {
+			defer s.releaseConn(ln.access, agentIp)
+			s.handleConnection(conn, agentIp)
+		}()
+	}
+}
+
+// 关闭所有监听
+func (s *IoServer) closeListeners() {
+	s.listenerLock.Lock()
+	defer s.listenerLock.Unlock()
+	for _, ln := range s.listeners {
+		ln.l.Close()
+	}
+}
+
+// 获取所有的准入控制
+func (s *IoServer) accessControls() []*accessControl {
+	s.listenerLock.Lock()
+	defer s.listenerLock.Unlock()
+	controls := []*accessControl{s.globalAccess, s.access}
+	for _, ln := range s.listeners {
+		controls = append(controls, ln.access)
+	}
+	return controls
+}
+
+// 启动所有监听，等待全部监听退出
+func (s *IoServer) serveAll(listeners []*ioListener) {
+	s.listenerLock.Lock()
+	s.listeners = listeners
+	s.listenerLock.Unlock()
+
+	wg := &sync.WaitGroup{}
+	for _, ln := range listeners {
+		wg.Add(1)
+		go func(ln *ioListener) {
+			defer wg.Done()
+			s.serve(ln)
+		}(ln)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 正在使用的socket文件不会被删除，遗留的socket文件会被清理
+func TestListenUnixStaleSocket(t *testing.T) {
+	setTestConf(t, "")
+	dir, err := ioutil.TempDir("", "microserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.sock")
+
+	running, err := listenUnix("listener.local", path)
+	if err != nil {
+		t.Fatalf("监听socket失败: %v", err)
+	}
+	if _, err := listenUnix("listener.local", path); err == nil {
+		t.Fatal("socket正在使用时应该返回错误")
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("正在运行的服务的socket被删除: %v", err)
+	}
+	conn.Close()
+
+	// 关闭时保留socket文件，模拟进程异常退出后遗留的文件
+	running.(*net.UnixListener).SetUnlinkOnClose(false)
+	running.Close()
+	l, err := listenUnix("listener.local", path)
+	if err != nil {
+		t.Fatalf("遗留的socket文件应该被清理: %v", err)
+	}
+	l.Close()
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"microserver/common"
+	cfg "microserver/common/configparse"
+	log "microserver/common/formatlog"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	连接存活检查，以服务端最近一次收到报文的时间为准，不依赖agent上报的心跳时间
+	- common.agentHeartbeatTimeout: 超过该时间没有收到任何报文则断开连接，单位分钟，默认3
+	- common.livenesscheckinterval: 检查间隔，单位秒，默认10
+*/
+
+const (
+	defaultAgentHeartbeatTimeout = 3
+	defaultLivenessCheckInterval = 10
+)
+
+func agentHeartbeatTimeout() int {
+	timeout := cfg.GlobalConf.GetInt("common", "agentHeartbeatTimeout")
+	if timeout <= 0 {
+		return defaultAgentHeartbeatTimeout
+	}
+	return timeout
+}
+
+// 记录收到报文的时间，收到任何报文都说明连接正常，清零未响应的探测
+func (c *Client) touch() {
+	atomic.StoreInt64(&c.lastRecvTime, time.Now().UnixNano())
+	atomic.StoreUint64(&c.pingOutstanding, 0)
+	atomic.StoreInt32(&c.pingMissed, 0)
+}
+
+// 获取服务端最近一次收到报文的时间
+func (c *Client) GetLastRecvTime() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.lastRecvTime))
+}
+
+// 客户端是否已经超时
+func (c *Client) Expired(now time.Time) bool {
+	return now.Sub(c.GetLastRecvTime()) > time.Duration(c.agentHeartbeatTimeout)*time.Minute
+}
+
+// 定期断开超时的客户端，读协程会因连接关闭而退出并清理客户端
+func (s *IoServer) livenessSweep() {
+	interval := cfg.GlobalConf.GetInt("common", "livenesscheckinterval")
+	if interval <= 0 {
+		interval = defaultLivenessCheckInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case now := <-ticker.C:
+			for _, c := range s.allClients() {
+				if !c.Expired(now) {
+					continue
+				}
+				log.Errorf("[IOServer] 客户端 %s 最近一次收到报文的时间 %s 超时，允许间隔 %d 分钟，断开连接", c.clientId, c.GetLastRecvTime().Format(common.TIME_FORMAT), c.agentHeartbeatTimeout)
+				c.setState(Erroring)
+				c.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package server
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"microserver/common"
+	cfg "microserver/common/configparse"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"microserver/controller"
+	"microserver/msg"
+	"microserver/structs"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+可追踪的广播操作，每次广播生成一个操作ID，随消息发送给agent，agent回复OperationAck确认收到和执行完成
+- operation.maxkeep: 内存中缓存的操作数，同时也是操作列表返回的数量，默认100
+- operation.ttl: 操作在数据库中的保留时间，单位秒，默认与离线消息的有效期相同
+操作和agent的状态写入数据库，内存中只缓存最近的操作，不在缓存中的操作从数据库加载，
+服务重启之后离线消息中的操作仍然可以查询和确认
+agent的状态只会向前推进: pending -> offline/failed -> delivered -> acked -> completed/failed
+agent回复的执行结果为最终状态，不在线的agent写入离线消息，重新连接收到后同样会回复确认
+*/
+
+const (
+	OperationPending   = "pending"   // 等待发送
+	OperationOffline   = "offline"   // agent不在线，已经写入离线消息
+	OperationDelivered = "delivered" // 已经写入连接
+	OperationAcked     = "acked"     // agent确认收到
+	OperationCompleted = "completed" // agent执行成功
+	OperationFailed    = "failed"    // 写入失败或者agent执行失败
+)
+
+const defaultOperationMaxKeep = 100
+
+var operationStatusRank = map[string]int{
+	OperationPending:   0,
+	OperationOffline:   1,
+	OperationFailed:    1,
+	OperationDelivered: 2,
+	OperationAcked:     3,
+	OperationCompleted: 4,
+}
+
+// agent在操作中的状态
+type OperationAgentStatus struct {
+	AgentId    string `json:"agentid"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	UpdateTime string `json:"updatetime"`
+	final      bool   // agent回复了执行结果，之后不再变化
+}
+
+// 操作的状态，Agents 只在查询单个操作时返回
+type OperationStatus struct {
+	OperationId string                  `json:"operationid"`
+	Type        string                  `json:"type"`
+	CreateTime  string                  `json:"createtime"`
+	Total       int                     `json:"total"`    // agent总数
+	Finished    int                     `json:"finished"` // 已经有执行结果的agent数
+	Counts      map[string]int          `json:"counts"`   // 各状态的agent数
+	Agents      []*OperationAgentStatus `json:"agents,omitempty"`
+}
+
+type operation struct {
+	id         string
+	opType     string
+	createTime time.Time
+	agents     map[string]*OperationAgentStatus
+}
+
+type operationTracker struct {
+	lock       *sync.Mutex
+	seq        uint64
+	operations map[string]*operation
+	order      []string // 按创建或者加载顺序排列的操作ID
+}
+
+func newOperationTracker() *operationTracker {
+	return &operationTracker{
+		lock:       &sync.Mutex{},
+		operations: map[string]*operation{},
+		order:      []string{},
+	}
+}
+
+func operationMaxKeep() int {
+	maxKeep := cfg.GlobalConf.GetInt("operation", "maxkeep")
+	if maxKeep <= 0 {
+		return defaultOperationMaxKeep
+	}
+	return maxKeep
+}
+
+// 操作在数据库中的保留时间，默认与离线消息的有效期相同，保证离线消息中的操作可以被确认
+func operationTtl() time.Duration {
+	ttl := cfg.GlobalConf.GetInt("operation", "ttl")
+	if ttl <= 0 {
+		return outboxTtl()
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// 加入内存缓存，超过缓存数量时删除最早的操作，调用方需要持有锁
+func (t *operationTracker) cache(op *operation) {
+	if _, ok := t.operations[op.id]; ok {
+		return
+	}
+	t.operations[op.id] = op
+	t.order = append(t.order, op.id)
+	for maxKeep := operationMaxKeep(); len(t.order) > maxKeep; {
+		delete(t.operations, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+// 生成一个新的操作，所有agent的状态为pending
+func (t *operationTracker) create(opType string, agentIds []string) string {
+	now := time.Now()
+	opId := fmt.Sprintf("%s-%d-%d", opType, now.UnixNano(), atomic.AddUint64(&t.seq, 1))
+	op := &operation{
+		id:         opId,
+		opType:     opType,
+		createTime: now,
+		agents:     map[string]*OperationAgentStatus{},
+	}
+	agents := []*structs.OperationAgent{}
+	for _, agentId := range agentIds {
+		agent := &OperationAgentStatus{
+			AgentId:    agentId,
+			Status:     OperationPending,
+			UpdateTime: now.Format(common.TIME_FORMAT),
+		}
+		op.agents[agentId] = agent
+		agents = append(agents, agent.record(opId))
+	}
+
+	record := &structs.Operation{
+		OperationId: opId,
+		OpType:      opType,
+		CreateTime:  now.Format(common.TIME_FORMAT),
+	}
+	if err := controller.Operationctrl.AddOperation(record, agents); err != nil {
+		log.Errorf("[IOServer] 操作 %s 写入数据库失败，只保留在内存中: %s", opId, err.Error())
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.cache(op)
+	return opId
+}
+
+// 获取操作，不在内存缓存中时从数据库加载
+func (t *operationTracker) get(opId string) (*operation, error) {
+	t.lock.Lock()
+	op, ok := t.operations[opId]
+	t.lock.Unlock()
+	if ok {
+		return op, nil
+	}
+
+	record, agents, err := controller.Operationctrl.GetOperation(opId)
+	if err != nil {
+		return nil, se.New(fmt.Sprintf("加载操作 %s 失败: %s", opId, err.Error()))
+	}
+	if record == nil {
+		return nil, se.New(fmt.Sprintf("操作 %s 不存在，可能已经被清理", opId))
+	}
+	createTime, _ := time.ParseInLocation(common.TIME_FORMAT, record.CreateTime, time.Local)
+	op = &operation{
+		id:         record.OperationId,
+		opType:     record.OpType,
+		createTime: createTime,
+		agents:     map[string]*OperationAgentStatus{},
+	}
+	for _, agent := range agents {
+		op.agents[agent.AgentId] = &OperationAgentStatus{
+			AgentId:    agent.AgentId,
+			Status:     agent.Status,
+			Error:      agent.Error,
+			UpdateTime: agent.UpdateTime,
+			final:      agent.Final,
+		}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	// 加载期间其它协程可能已经加载了该操作，使用已经缓存的对象
+	if cached, ok := t.operations[opId]; ok {
+		return cached, nil
+	}
+	t.cache(op)
+	return op, nil
+}
+
+// 更新agent在操作中的状态，final为true表示agent回复的执行结果
+// 只更新操作生成时登记的目标agent，操作不存在或者agent不是目标时返回错误
+func (t *operationTracker) update(opId string, agentId string, status string, errMsg string, final bool) error {
+	op, err := t.get(opId)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	agent, ok := op.agents[agentId]
+	if !ok {
+		return se.New(fmt.Sprintf("%s 不是操作 %s 的目标agent", agentId, opId))
+	}
+	if agent.final || (!final && operationStatusRank[status] < operationStatusRank[agent.Status]) {
+		return nil
+	}
+	agent.Status = status
+	agent.Error = errMsg
+	agent.final = final
+	agent.UpdateTime = time.Now().Format(common.TIME_FORMAT)
+	// 持有锁写入数据库，保证数据库中的状态与内存中的更新顺序一致
+	if err := controller.Operationctrl.UpdateOperationAgent(agent.record(opId)); err != nil {
+		log.Errorf("[IOServer] 操作 %s 中 %s 的状态写入数据库失败: %s", opId, agentId, err.Error())
+	}
+	return nil
+}
+
+// 清理创建时间早于before的操作
+func (t *operationTracker) purge(before time.Time) {
+	cnt, err := controller.Operationctrl.PurgeOperations(before.Format(common.TIME_FORMAT))
+	if err != nil {
+		log.Errorf("[IOServer] 清理过期的操作失败: %s", err.Error())
+	} else if cnt > 0 {
+		log.Infof("[IOServer] 清理过期的操作记录 %d 条", cnt)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	order := []string{}
+	for _, opId := range t.order {
+		if t.operations[opId].createTime.After(before) {
+			order = append(order, opId)
+		} else {
+			delete(t.operations, opId)
+		}
+	}
+	t.order = order
+}
+
+// 转换为数据库中的记录
+func (agent *OperationAgentStatus) record(opId string) *structs.OperationAgent {
+	return &structs.OperationAgent{
+		OperationId: opId,
+		AgentId:     agent.AgentId,
+		Status:      agent.Status,
+		Error:       agent.Error,
+		Final:       agent.final,
+		UpdateTime:  agent.UpdateTime,
+	}
+}
+
+// 生成操作的状态，withAgents为true时包含每个agent的状态
+func (op *operation) status(withAgents bool) *OperationStatus {
+	stats := &OperationStatus{
+		OperationId: op.id,
+		Type:        op.opType,
+		CreateTime:  op.createTime.Format(common.TIME_FORMAT),
+		Total:       len(op.agents),
+		Counts:      map[string]int{},
+	}
+	for _, agent := range op.agents {
+		stats.Counts[agent.Status]++
+		if agent.final {
+			stats.Finished++
+		}
+		if withAgents {
+			agentStatus := *agent
+			stats.Agents = append(stats.Agents, &agentStatus)
+		}
+	}
+	sort.Slice(stats.Agents, func(i, j int) bool {
+		return stats.Agents[i].AgentId < stats.Agents[j].AgentId
+	})
+	return stats
+}
+
+// 获取操作的状态，包含每个agent的状态
+func (s *IoServer) GetOperation(opId string) (*OperationStatus, bool) {
+	t := s.operations
+	op, err := t.get(opId)
+	if err != nil {
+		log.Debugf("[IOServer] 获取操作失败: %s", err.Error())
+		return nil, false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return op.status(true), true
+}
+
+// 获取最近的操作的汇总状态，最新的操作在前，数据库不可用时返回内存中缓存的操作
+func (s *IoServer) ListOperations() []*OperationStatus {
+	t := s.operations
+	opIds, err := controller.Operationctrl.ListOperationIds(operationMaxKeep())
+	if err != nil {
+		log.Errorf("[IOServer] 获取操作列表失败，返回内存中的操作: %s", err.Error())
+		t.lock.Lock()
+		opIds = []string{}
+		for idx := len(t.order) - 1; idx >= 0; idx-- {
+			opIds = append(opIds, t.order[idx])
+		}
+		t.lock.Unlock()
+	}
+
+	result := []*OperationStatus{}
+	for _, opId := range opIds {
+		op, err := t.get(opId)
+		if err != nil {
+			continue
+		}
+		t.lock.Lock()
+		result = append(result, op.status(false))
+		t.lock.Unlock()
+	}
+	return result
+}
+
+// 向一组agent发送操作消息并记录发送结果，不在线的agent写入离线消息
+func (s *IoServer) deliverOperation(opId string, agentIds []string, agentMsg *msg.Msg) {
+	wg := &sync.WaitGroup{}
+	for _, agentId := range agentIds {
+		wg.Add(1)
+		go func(agentId string) {
+			defer wg.Done()
+			result := s.SendOrQueue(agentId, agentMsg, 0)
+			// 离线消息发送成功时状态已经是delivered，状态只会向前推进，不会被覆盖
+			switch result.Status {
+			case DeliverySent:
+				s.operations.update(opId, agentId, OperationDelivered, "", false)
+			case DeliveryQueued:
+				s.operations.update(opId, agentId, OperationOffline, "", false)
+			default:
+				s.operations.update(opId, agentId, OperationFailed, result.Error, false)
+			}
+		}(agentId)
+	}
+	wg.Wait()
+	log.Infof("[IOServer] 操作 %s 发送完成, agent数: %d", opId, len(agentIds))
+}
+
+// 离线消息发送成功后，消息中带有操作ID时将agent在操作中的状态更新为delivered
+func (s *IoServer) markOutboxDelivered(agentId string, item *structs.OutboxItem) {
+	if item.MsgType != msg.SERVER_MSG_AGENT_UPDATE {
+		return
+	}
+	updateMsg := &msg.UpdateMsg{}
+	if err := proto.Unmarshal(item.Payload, updateMsg); err != nil {
+		log.Errorf("[IOServer] 解析 %s 的离线消息失败, id: %d, 错误信息: %s", agentId, item.Id, err.Error())
+		return
+	}
+	if updateMsg.OperationId == "" {
+		return
+	}
+	if err := s.operations.update(updateMsg.OperationId, agentId, OperationDelivered, "", false); err != nil {
+		log.Debugf("[IOServer] 更新 %s 的操作状态失败: %s", agentId, err.Error())
+	}
+}
+
+// 处理agent对操作的确认
+func (s *IoServer) handleClientOperationAckMsg(client *Client, agentMsg *msg.Msg) {
+	ack := agentMsg.Msg.(*msg.OperationAck)
+	log.Debugf("[IOServer] 接收到 %s 的操作确认, operationId: %s, stage: %d, success: %v", client.clientId, ack.OperationId, ack.Stage, ack.Success)
+
+	var err error
+	switch ack.Stage {
+	case msg.OPERATION_ACK_RECEIVED:
+		err = s.operations.update(ack.OperationId, client.clientId, OperationAcked, "", false)
+	case msg.OPERATION_ACK_COMPLETED:
+		if ack.Success {
+			err = s.operations.update(ack.OperationId, client.clientId, OperationCompleted, "", true)
+		} else {
+			err = s.operations.update(ack.OperationId, client.clientId, OperationFailed, ack.Error, true)
+		}
+	default:
+		log.Warnf("[IOServer] %s 的操作确认阶段 %d 不合法, operationId: %s", client.clientId, ack.Stage, ack.OperationId)
+		return
+	}
+	if err != nil {
+		log.Warnf("[IOServer] 忽略 %s 的操作确认: %s", client.clientId, err.Error())
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"github.com/golang/protobuf/proto"
+	"microserver/msg"
+	"microserver/structs"
+	"testing"
+	"time"
+)
+
+func TestOperationUpdateRejectsNonTarget(t *testing.T) {
+	tracker := newOperationTracker()
+	opId := tracker.create("update", []string{"agent1"})
+
+	if err := tracker.update(opId, "agent2", OperationAcked, "", false); err == nil {
+		t.Errorf("非目标agent的确认被接受")
+	}
+	if err := tracker.update("missing", "agent1", OperationAcked, "", false); err == nil {
+		t.Errorf("不存在的操作的确认被接受")
+	}
+	if err := tracker.update(opId, "agent1", OperationAcked, "", false); err != nil {
+		t.Errorf("目标agent的确认被拒绝: %v", err)
+	}
+	stats := tracker.operations[opId].status(true)
+	if stats.Total != 1 || len(stats.Agents) != 1 {
+		t.Errorf("操作的agent数为 %d，期望 1", stats.Total)
+	}
+}
+
+func TestMarkOutboxDelivered(t *testing.T) {
+	s := newTestServer()
+	s.operations = newOperationTracker()
+	opId := s.operations.create("update", []string{"agent1"})
+	if err := s.operations.update(opId, "agent1", OperationOffline, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := proto.Marshal(&msg.UpdateMsg{Updateswitch: true, OperationId: opId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.markOutboxDelivered("agent1", &structs.OutboxItem{MsgType: msg.SERVER_MSG_AGENT_UPDATE, Payload: payload})
+
+	if status := s.operations.operations[opId].agents["agent1"].Status; status != OperationDelivered {
+		t.Errorf("离线消息发送后状态为 %s，期望 %s", status, OperationDelivered)
+	}
+}
+
+// 内存中只缓存最近的操作，超过缓存数量的操作需要从数据库加载
+func TestOperationCacheEviction(t *testing.T) {
+	setTestConf(t, "[operation]\nmaxkeep = 2\n")
+	tracker := newOperationTracker()
+	first := tracker.create("update", []string{"agent1"})
+	tracker.create("update", []string{"agent1"})
+	last := tracker.create("update", []string{"agent1"})
+
+	if _, ok := tracker.operations[first]; ok {
+		t.Error("超过缓存数量的操作应该从内存中删除")
+	}
+	if len(tracker.order) != 2 || tracker.order[1] != last {
+		t.Errorf("缓存的操作为 %v，期望最近的2个操作", tracker.order)
+	}
+	// 测试环境没有数据库，不在缓存中的操作加载失败
+	if _, err := tracker.get(first); err == nil {
+		t.Error("数据库不可用时加载不在缓存中的操作应该返回错误")
+	}
+	if _, err := tracker.get(last); err != nil {
+		t.Errorf("缓存中的操作获取失败: %v", err)
+	}
+}
+
+func TestOperationPurge(t *testing.T) {
+	tracker := newOperationTracker()
+	opId := tracker.create("update", []string{"agent1"})
+	tracker.purge(time.Now().Add(-time.Hour))
+	if _, ok := tracker.operations[opId]; !ok {
+		t.Fatal("没有过期的操作不应该被清理")
+	}
+	tracker.purge(time.Now().Add(time.Second))
+	if _, ok := tracker.operations[opId]; ok || len(tracker.order) != 0 {
+		t.Error("过期的操作应该从内存中清理")
+	}
+}
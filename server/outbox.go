@@ -0,0 +1,249 @@
+package server
+
+import (
+	"github.com/golang/protobuf/proto"
+	"microserver/common"
+	cfg "microserver/common/configparse"
+	log "microserver/common/formatlog"
+	"microserver/controller"
+	"microserver/msg"
+	"microserver/structs"
+	"sync"
+	"time"
+)
+
+/*
+离线消息，agent不在线时消息写入数据库，agent重新连接后按写入顺序发送，microserver.ini 中的 [outbox]:
+- ttl: 离线消息的默认有效期，单位秒，默认86400
+- purgeinterval: 清理过期消息的间隔，单位秒，默认600
+每条消息发送之前先从数据库删除(认领)，删除不到说明消息已经被取消，不再发送
+发送失败时使用原来的ID写回数据库，agent下次连接时按原来的顺序发送
+*/
+
+const (
+	defaultOutboxTtl           = 86400
+	defaultOutboxPurgeInterval = 600
+)
+
+type outbox struct {
+	lock     *sync.Mutex
+	flushing map[string]bool // 正在发送离线消息的agent
+	rerun    map[string]bool // 发送期间有新的离线消息，需要再发送一次
+}
+
+func newOutbox() *outbox {
+	return &outbox{
+		lock:     &sync.Mutex{},
+		flushing: map[string]bool{},
+		rerun:    map[string]bool{},
+	}
+}
+
+func outboxTtl() time.Duration {
+	ttl := cfg.GlobalConf.GetInt("outbox", "ttl")
+	if ttl <= 0 {
+		ttl = defaultOutboxTtl
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// 将消息写入agent的离线消息，ttl小于等于0时使用默认有效期
+func (s *IoServer) queueOutbox(agentId string, agentMsg *msg.Msg, ttl time.Duration) (int64, error) {
+	payload := agentMsg.RawDatas
+	if agentMsg.Msg != nil {
+		var err error
+		payload, err = proto.Marshal(agentMsg.Msg)
+		if err != nil {
+			log.Errorf("[IOServer] protobuf消息生成失败: %s", err.Error())
+			return 0, err
+		}
+	}
+	if ttl <= 0 {
+		ttl = outboxTtl()
+	}
+
+	now := time.Now()
+	id, err := controller.Outboxctrl.AddOutboxItem(&structs.OutboxItem{
+		AgentId:    agentId,
+		MsgType:    agentMsg.Type,
+		Payload:    payload,
+		CreateTime: now.Format(common.TIME_FORMAT),
+		ExpireTime: now.Add(ttl).Format(common.TIME_FORMAT),
+	})
+	if err != nil {
+		log.Errorf("[IOServer] 写入 %s 的离线消息失败, 消息类型 %d, 错误信息: %s", agentId, agentMsg.Type, err.Error())
+		return 0, err
+	}
+	log.Infof("[IOServer] 消息写入 %s 的离线消息, id: %d, 消息类型 %d, 有效期 %s", agentId, id, agentMsg.Type, ttl)
+
+	// 写入期间agent可能已经重新连接并发送完离线消息
+	if _, ok := s.getClient(agentId); ok {
+		go s.flushOutbox(agentId)
+	}
+	return id, nil
+}
+
+// agent是否有还没有发送的离线消息，包括正在发送中的
+func (s *IoServer) outboxPending(agentId string) bool {
+	s.outbox.lock.Lock()
+	flushing := s.outbox.flushing[agentId]
+	s.outbox.lock.Unlock()
+	if flushing {
+		return true
+	}
+	cnt, err := controller.Outboxctrl.CountOutboxItems(agentId, time.Now().Format(common.TIME_FORMAT))
+	if err != nil {
+		log.Errorf("[IOServer] 获取 %s 的离线消息数量失败: %s", agentId, err.Error())
+		return false
+	}
+	return cnt > 0
+}
+
+// 向指定agent发送消息，agent不在线或者发送失败时写入离线消息
+// agent还有没有发送的离线消息时同样写入离线消息，保证按顺序送达
+func (s *IoServer) SendOrQueue(agentId string, agentMsg *msg.Msg, ttl time.Duration) *DeliveryResult {
+	var result *DeliveryResult
+	if s.outboxPending(agentId) {
+		result = &DeliveryResult{AgentId: agentId, Status: DeliveryQueued}
+	} else {
+		result = s.SendToAgent(agentId, agentMsg)
+		if result.Status == DeliverySent {
+			return result
+		}
+	}
+	id, err := s.queueOutbox(agentId, agentMsg, ttl)
+	if err != nil {
+		if result.Status == DeliveryQueued {
+			result.Status = DeliveryWriteFailed
+		}
+		result.Error = err.Error()
+		return result
+	}
+	return &DeliveryResult{AgentId: agentId, Status: DeliveryQueued, OutboxId: id}
+}
+
+// 向一组agent发送消息，不在线的agent写入离线消息，返回每个agent的发送结果，顺序与agentIds一致
+func (s *IoServer) SendOrQueueToAgents(agentIds []string, agentMsg *msg.Msg, ttl time.Duration) []*DeliveryResult {
+	results := make([]*DeliveryResult, len(agentIds))
+	wg := &sync.WaitGroup{}
+	for idx, agentId := range agentIds {
+		wg.Add(1)
+		go func(idx int, agentId string) {
+			defer wg.Done()
+			results[idx] = s.SendOrQueue(agentId, agentMsg, ttl)
+		}(idx, agentId)
+	}
+	wg.Wait()
+	return results
+}
+
+// 向agent发送离线消息，同一个agent同时只有一个协程在发送
+func (s *IoServer) flushOutbox(agentId string) {
+	o := s.outbox
+	o.lock.Lock()
+	if o.flushing[agentId] {
+		o.rerun[agentId] = true
+		o.lock.Unlock()
+		return
+	}
+	o.flushing[agentId] = true
+	o.lock.Unlock()
+
+	for {
+		s.deliverOutbox(agentId)
+
+		o.lock.Lock()
+		if o.rerun[agentId] {
+			delete(o.rerun, agentId)
+			o.lock.Unlock()
+			continue
+		}
+		delete(o.flushing, agentId)
+		o.lock.Unlock()
+		return
+	}
+}
+
+// 按写入顺序发送离线消息，发送失败时停止，剩余的消息等待下次连接
+// 读取之后被取消的消息在认领时跳过
+func (s *IoServer) deliverOutbox(agentId string) {
+	items, err := controller.Outboxctrl.ListOutboxItems(agentId, time.Now().Format(common.TIME_FORMAT))
+	if err != nil {
+		log.Errorf("[IOServer] 获取 %s 的离线消息失败: %s", agentId, err.Error())
+		return
+	}
+	for _, item := range items {
+		client, ok := s.getClient(agentId)
+		if !ok {
+			return
+		}
+		claimed, err := controller.Outboxctrl.DeleteOutboxItem(agentId, item.Id)
+		if err != nil {
+			log.Errorf("[IOServer] 认领 %s 的离线消息失败, id: %d, 错误信息: %s", agentId, item.Id, err.Error())
+			return
+		}
+		if !claimed {
+			log.Infof("[IOServer] %s 的离线消息已经被取消, id: %d", agentId, item.Id)
+			continue
+		}
+		agentMsg := &msg.Msg{
+			Type:     item.MsgType,
+			RawDatas: item.Payload,
+		}
+		if err := client.SendMsgWait(agentMsg); err != nil {
+			log.Errorf("[IOServer] 向 %s 发送离线消息失败, id: %d, 错误信息: %s", agentId, item.Id, err.Error())
+			if err := controller.Outboxctrl.RestoreOutboxItem(item); err != nil {
+				log.Errorf("[IOServer] 写回 %s 的离线消息失败，消息丢失, id: %d, 错误信息: %s", agentId, item.Id, err.Error())
+			}
+			return
+		}
+		log.Infof("[IOServer] 向 %s 发送离线消息成功, id: %d, 消息类型 %d", agentId, item.Id, item.MsgType)
+		s.markOutboxDelivered(agentId, item)
+	}
+}
+
+// 获取agent等待发送的离线消息
+func (s *IoServer) ListOutbox(agentId string) ([]*structs.OutboxItem, error) {
+	return controller.Outboxctrl.ListOutboxItems(agentId, time.Now().Format(common.TIME_FORMAT))
+}
+
+// 取消agent的一条离线消息，返回消息是否存在
+func (s *IoServer) CancelOutbox(agentId string, id int64) (bool, error) {
+	ok, err := controller.Outboxctrl.DeleteOutboxItem(agentId, id)
+	if err != nil {
+		log.Errorf("[IOServer] 取消 %s 的离线消息失败, id: %d, 错误信息: %s", agentId, id, err.Error())
+		return false, err
+	}
+	if ok {
+		log.Infof("[IOServer] 取消 %s 的离线消息, id: %d", agentId, id)
+	}
+	return ok, nil
+}
+
+// 定期清理过期的离线消息和操作
+func (s *IoServer) outboxPurgeLoop() {
+	interval := cfg.GlobalConf.GetInt("outbox", "purgeinterval")
+	if interval <= 0 {
+		interval = defaultOutboxPurgeInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case now := <-ticker.C:
+			// 操作的保留时间不短于离线消息，离线消息中的操作在过期之前都可以被确认
+			s.operations.purge(now.Add(-operationTtl()))
+			cnt, err := controller.Outboxctrl.PurgeExpiredOutboxItems(now.Format(common.TIME_FORMAT))
+			if err != nil {
+				log.Errorf("[IOServer] 清理过期的离线消息失败: %s", err.Error())
+				continue
+			}
+			if cnt > 0 {
+				log.Infof("[IOServer] 清理过期的离线消息 %d 条", cnt)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"microserver/common"
+	cfg "microserver/common/configparse"
+	log "microserver/common/formatlog"
+	"microserver/msg"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	服务端主动探测空闲的客户端
+	- common.pinginterval: 超过该时间没有收到报文的客户端会被探测，同时也是探测间隔，单位秒，默认30
+	- common.pingmaxmissed: 连续没有响应的探测次数达到该值时断开连接，默认3
+	agent收到 SERVER_MSG_PING 后使用 CLIENT_MSG_PONG 原样返回
+	只探测协商了协议版本2以上或者ping能力的客户端，版本1的agent只依赖存活检查
+	收到任何报文都会清零未响应的探测，连续未响应次数只在客户端完全没有报文时累加
+*/
+
+const (
+	defaultPingInterval  = 30
+	defaultPingMaxMissed = 3
+)
+
+// 客户端的探测统计
+type PingStats struct {
+	RttMs        float64 `json:"rttms"`        // 最近一次探测的往返时间，单位毫秒，没有探测结果时为0
+	MissedPings  int32   `json:"missedpings"`  // 连续没有响应的探测次数
+	LastPongTime string  `json:"lastpongtime"` // 最近一次收到探测响应的时间
+}
+
+// 发送的探测报文，往返时间以服务端记录的发送时间计算，不使用agent返回的时间
+type pingRecord struct {
+	seq      uint64
+	sendTime time.Time
+}
+
+// 定期探测空闲的客户端
+func (s *IoServer) pingLoop() {
+	interval := cfg.GlobalConf.GetInt("common", "pinginterval")
+	if interval <= 0 {
+		interval = defaultPingInterval
+	}
+	maxMissed := cfg.GlobalConf.GetInt("common", "pingmaxmissed")
+	if maxMissed <= 0 {
+		maxMissed = defaultPingMaxMissed
+	}
+	idle := time.Duration(interval) * time.Second
+	ticker := time.NewTicker(idle)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case now := <-ticker.C:
+			for _, c := range s.allClients() {
+				if !c.supportsPing() || now.Sub(c.GetLastRecvTime()) < idle {
+					continue
+				}
+				// 上一次的探测还没有响应
+				if atomic.LoadUint64(&c.pingOutstanding) != 0 {
+					missed := atomic.AddInt32(&c.pingMissed, 1)
+					if int(missed) >= maxMissed {
+						log.Errorf("[IOServer] 客户端 %s 连续 %d 次没有响应探测，断开连接", c.clientId, missed)
+						c.setState(Erroring)
+						c.Close()
+						continue
+					}
+				}
+				c.sendPing(now)
+			}
+		}
+	}
+}
+
+// 客户端是否支持探测报文
+func (c *Client) supportsPing() bool {
+	return c.GetProtocolVersion() >= msg.PROTOCOL_VERSION_2 || c.HasCapability(msg.CAPABILITY_PING)
+}
+
+// 发送探测报文
+func (c *Client) sendPing(now time.Time) {
+	seq := atomic.AddUint64(&c.pingSeq, 1)
+	c.pingSent.Store(&pingRecord{seq: seq, sendTime: now})
+	atomic.StoreUint64(&c.pingOutstanding, seq)
+	log.Debugf("[IOServer] 向 %s 发送探测报文, seq: %d", c.clientId, seq)
+	// 队列满时直接丢弃，不阻塞其它客户端的探测，没有响应会计入未响应次数
+	c.trySendMsg(&msg.Msg{
+		Type: msg.SERVER_MSG_PING,
+		Msg: &msg.Ping{
+			Seq:      seq,
+			SendTime: now.UnixNano(),
+		},
+	})
+}
+
+// 处理探测响应，往返时间以服务端记录的发送时间计算
+func (s *IoServer) handleClientPongMsg(client *Client, agentMsg *msg.Msg) {
+	pong := agentMsg.Msg.(*msg.Ping)
+	// 收到报文时已经清零了未响应的探测，这里只需要确认是最近一次发送的探测
+	sent, _ := client.pingSent.Load().(*pingRecord)
+	if sent == nil || pong.Seq != sent.seq {
+		log.Warnf("[IOServer] %s 的探测响应没有对应的探测，可能已经过期, seq: %d", client.clientId, pong.Seq)
+		return
+	}
+	now := time.Now()
+	rtt := int64(now.Sub(sent.sendTime))
+	atomic.StoreInt64(&client.pingRtt, rtt)
+	atomic.StoreInt64(&client.lastPongTime, now.UnixNano())
+	log.Debugf("[IOServer] 收到 %s 的探测响应, seq: %d, rtt: %v", client.clientId, pong.Seq, time.Duration(rtt))
+}
+
+// 获取探测统计
+func (c *Client) GetPingStats() PingStats {
+	stats := PingStats{
+		RttMs:       float64(atomic.LoadInt64(&c.pingRtt)) / float64(time.Millisecond),
+		MissedPings: atomic.LoadInt32(&c.pingMissed),
+	}
+	if lastPong := atomic.LoadInt64(&c.lastPongTime); lastPong != 0 {
+		stats.LastPongTime = time.Unix(0, lastPong).Format(common.TIME_FORMAT)
+	}
+	return stats
+}
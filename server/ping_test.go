@@ -0,0 +1,70 @@
+package server
+
+import (
+	"microserver/msg"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSupportsPing(t *testing.T) {
+	client, _ := newTestClient(t, "agent-1")
+	if client.supportsPing() {
+		t.Error("协议版本1的客户端不应该被探测")
+	}
+	client.setProtocol(&protocolNegotiation{version: msg.PROTOCOL_VERSION_2})
+	if !client.supportsPing() {
+		t.Error("协议版本2的客户端应该被探测")
+	}
+}
+
+func TestTouchResetsMissedPings(t *testing.T) {
+	s := newTestServer()
+	client, _ := newTestClient(t, "agent-1")
+
+	// 模拟两次没有响应的探测
+	now := time.Now()
+	client.sendPing(now)
+	client.sendPing(now)
+	seq := atomic.LoadUint64(&client.pingSeq)
+	atomic.StoreInt32(&client.pingMissed, 2)
+
+	// 收到Pong报文时读协程先调用touch，之后才交给处理函数
+	client.touch()
+	if atomic.LoadInt32(&client.pingMissed) != 0 || atomic.LoadUint64(&client.pingOutstanding) != 0 {
+		t.Fatal("收到报文后应该清零未响应的探测")
+	}
+	s.handleClientPongMsg(client, &msg.Msg{
+		Type: msg.CLIENT_MSG_PONG,
+		Msg:  &msg.Ping{Seq: seq, SendTime: now.UnixNano()},
+	})
+	if client.GetPingStats().LastPongTime == "" {
+		t.Error("最近一次探测的响应应该被记录")
+	}
+
+	// 过期的探测响应不更新统计
+	atomic.StoreInt64(&client.lastPongTime, 0)
+	s.handleClientPongMsg(client, &msg.Msg{
+		Type: msg.CLIENT_MSG_PONG,
+		Msg:  &msg.Ping{Seq: seq - 1, SendTime: now.UnixNano()},
+	})
+	if client.GetPingStats().LastPongTime != "" {
+		t.Error("过期的探测响应不应该被记录")
+	}
+}
+
+// 往返时间使用服务端记录的发送时间，agent返回的发送时间不影响结果
+func TestPongRttIgnoresAgentSendTime(t *testing.T) {
+	s := newTestServer()
+	client, _ := newTestClient(t, "agent-1")
+
+	client.sendPing(time.Now())
+	seq := atomic.LoadUint64(&client.pingSeq)
+	s.handleClientPongMsg(client, &msg.Msg{
+		Type: msg.CLIENT_MSG_PONG,
+		Msg:  &msg.Ping{Seq: seq, SendTime: 0},
+	})
+	if rtt := client.GetPingStats().RttMs; rtt < 0 || rtt > 1000 {
+		t.Errorf("往返时间为 %v 毫秒，应该以服务端的发送时间计算", rtt)
+	}
+}
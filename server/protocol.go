@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"microserver/msg"
+	"sync/atomic"
+)
+
+// 服务端支持的协议版本，按优先级从高到低排列
+var supportedProtocolVersions = []uint32{msg.PROTOCOL_VERSION_2, msg.PROTOCOL_VERSION_1}
+
+const (
+	// 协议版本2中消息类型字段的高8位为报文标记
+	frameFlagsShift = 24
+	frameTypeMask   = 1<<frameFlagsShift - 1
+)
+
+// 协商结果
+type protocolNegotiation struct {
+	version      uint32
+	capabilities []string
+}
+
+// 根据agent支持的版本和能力协商，agent没有携带版本信息时按版本1处理
+func negotiateProtocol(versions []uint32, capabilities []string) (*protocolNegotiation, error) {
+	if len(versions) == 0 {
+		versions = []uint32{msg.PROTOCOL_VERSION_1}
+	}
+
+	negotiated := &protocolNegotiation{}
+	for _, supported := range supportedProtocolVersions {
+		for _, v := range versions {
+			if v == supported {
+				negotiated.version = v
+				break
+			}
+		}
+		if negotiated.version != 0 {
+			break
+		}
+	}
+	if negotiated.version == 0 {
+		return nil, se.New(fmt.Sprintf("没有双方都支持的协议版本, agent支持的版本: %v, 服务端支持的版本: %v", versions, supportedProtocolVersions))
+	}
+
+	// 协议版本1不支持报文标记，也就不支持需要报文标记的能力
+	negotiated.capabilities = []string{}
+	if negotiated.version >= msg.PROTOCOL_VERSION_2 {
+		for _, c := range capabilities {
+			for _, supported := range serverCapabilities() {
+				if c == supported {
+					negotiated.capabilities = append(negotiated.capabilities, c)
+					break
+				}
+			}
+		}
+	}
+	return negotiated, nil
+}
+
+// 设置协商后的协议版本和能力，需要在认证响应发送之后调用
+func (c *Client) setProtocol(negotiated *protocolNegotiation) {
+	capabilities := map[string]bool{}
+	for _, name := range negotiated.capabilities {
+		capabilities[name] = true
+	}
+	c.capabilities = capabilities
+	atomic.StoreUint32(&c.protoVersion, negotiated.version)
+	log.Infof("[IOServer] %s 协商的协议版本: %d, 能力: %v", c.clientId, negotiated.version, negotiated.capabilities)
+}
+
+// 获取协商后的协议版本
+func (c *Client) GetProtocolVersion() uint32 {
+	return atomic.LoadUint32(&c.protoVersion)
+}
+
+// 是否协商了指定的能力
+func (c *Client) HasCapability(name string) bool {
+	return c.capabilities[name]
+}
+
+// 解析报文头中的消息类型字段，返回消息类型和报文标记
+func (c *Client) splitFrameType(rawType uint64) (uint64, uint32) {
+	if c.GetProtocolVersion() < msg.PROTOCOL_VERSION_2 {
+		return rawType, 0
+	}
+	return rawType & frameTypeMask, uint32(rawType >> frameFlagsShift)
+}
+
+// 生成报文头中的消息类型字段
+func (c *Client) joinFrameType(msgType uint64, flags uint32) uint64 {
+	if c.GetProtocolVersion() < msg.PROTOCOL_VERSION_2 {
+		return msgType
+	}
+	return msgType&frameTypeMask | uint64(flags)<<frameFlagsShift
+}
+
+// 当前协商结果下允许出现的报文标记
+func (c *Client) allowedFrameFlags() uint32 {
+	var flags uint32
+	if c.HasCapability(msg.CAPABILITY_GZIP) {
+		flags |= msg.FRAME_FLAG_GZIP
+	}
+	return flags
+}
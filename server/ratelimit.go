@@ -0,0 +1,219 @@
+package server
+
+import (
+	"math"
+	cfg "microserver/common/configparse"
+	log "microserver/common/formatlog"
+	"microserver/msg"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+每个客户端的接收限流，使用令牌桶算法，microserver.ini 中的 [ratelimit]:
+- msgrate: 每秒允许接收的消息数，0表示不限制(默认)
+- msgburst: 消息数的突发上限，默认等于msgrate
+- byterate: 每秒允许接收的消息体字节数(解压后)，0表示不限制(默认)
+- byteburst: 字节数的突发上限，默认等于byterate，drop策略下超过该长度的报文总是被丢弃
+- msgrate.<消息类型>: 指定消息类型每秒允许接收的消息数，如 msgrate.2 = 10
+- msgburst.<消息类型>: 指定消息类型的突发上限，默认等于对应的msgrate
+- policy: 超过限制时的处理策略
+  - drop: 丢弃当前消息(默认)
+  - delay: 暂停读取，等待令牌足够后再处理
+  - disconnect: 断开客户端连接
+
+心跳、同步请求的响应、探测响应和操作确认属于协议控制报文，不受限流影响
+*/
+const (
+	RateLimitDrop       = "drop"
+	RateLimitDelay      = "delay"
+	RateLimitDisconnect = "disconnect"
+)
+
+// 不受限流影响的协议控制报文，丢弃后会导致agent读超时、同步请求超时或者操作确认丢失
+var rateLimitExempt = map[uint64]bool{
+	msg.CLIENT_MSG_HEARTBEAT:     true,
+	msg.CLIENT_MSG_RPC_RESPONSE:  true,
+	msg.CLIENT_MSG_PONG:          true,
+	msg.CLIENT_MSG_OPERATION_ACK: true,
+}
+
+// 限流统计
+type RateLimitStats struct {
+	Dropped uint64 `json:"dropped"` // 被丢弃的报文数
+	Delayed uint64 `json:"delayed"` // 被延迟处理的报文数
+	DelayMs int64  `json:"delayms"` // 累计延迟时间，单位毫秒
+}
+
+type tokenBucket struct {
+	rate   float64 // 每秒补充的令牌数
+	burst  float64 // 令牌上限
+	tokens float64 // 当前令牌数，delay策略下可以为负数
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// 补充令牌
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// 令牌足够时需要等待的时间
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+type rateLimiter struct {
+	policy  string
+	msgs    *tokenBucket            // 消息数限流，为nil表示不限制
+	bytes   *tokenBucket            // 字节数限流，为nil表示不限制
+	msgType map[uint64]*tokenBucket // 按消息类型的消息数限流
+}
+
+func rateLimitPolicy(policy string) string {
+	switch policy {
+	case RateLimitDelay, RateLimitDisconnect:
+		return policy
+	case "", RateLimitDrop:
+		return RateLimitDrop
+	default:
+		log.Warnf("[IOServer] 未知的限流策略 %s，使用默认策略 %s", policy, RateLimitDrop)
+		return RateLimitDrop
+	}
+}
+
+// 按配置生成限流器，没有配置任何限制时返回nil
+func newRateLimiter() *rateLimiter {
+	conf := cfg.GlobalConf.GetSection("ratelimit")
+	limiter := &rateLimiter{
+		policy:  rateLimitPolicy(cfg.GlobalConf.GetStr("ratelimit", "policy")),
+		msgType: map[uint64]*tokenBucket{},
+	}
+	if rate := cfg.GlobalConf.GetInt("ratelimit", "msgrate"); rate > 0 {
+		limiter.msgs = newTokenBucket(rate, cfg.GlobalConf.GetInt("ratelimit", "msgburst"))
+	}
+	if rate := cfg.GlobalConf.GetInt("ratelimit", "byterate"); rate > 0 {
+		limiter.bytes = newTokenBucket(rate, cfg.GlobalConf.GetInt("ratelimit", "byteburst"))
+	}
+	for key, value := range conf {
+		if !strings.HasPrefix(key, "msgrate.") {
+			continue
+		}
+		msgType, err := strconv.ParseUint(strings.TrimPrefix(key, "msgrate."), 10, 64)
+		if err != nil {
+			log.Warnf("[IOServer] 限流配置 %s 的消息类型不合法，忽略该配置", key)
+			continue
+		}
+		if rateLimitExempt[msgType] {
+			log.Warnf("[IOServer] 消息类型 %d 为协议控制报文，不受限流影响，忽略限流配置 %s", msgType, key)
+			continue
+		}
+		rate, _ := strconv.Atoi(value)
+		if rate <= 0 {
+			continue
+		}
+		burst, _ := strconv.Atoi(conf["msgburst."+strings.TrimPrefix(key, "msgrate.")])
+		limiter.msgType[msgType] = newTokenBucket(rate, burst)
+	}
+
+	if limiter.msgs == nil && limiter.bytes == nil && len(limiter.msgType) == 0 {
+		return nil
+	}
+	return limiter
+}
+
+// 检查消息是否超过限制，返回需要等待的时间，allow为true时消耗令牌
+func (r *rateLimiter) reserve(agentMsg *msg.Msg, now time.Time, allow bool) time.Duration {
+	type cost struct {
+		bucket *tokenBucket
+		n      float64
+	}
+	costs := []cost{}
+	if r.msgs != nil {
+		costs = append(costs, cost{r.msgs, 1})
+	}
+	if r.bytes != nil {
+		costs = append(costs, cost{r.bytes, float64(len(agentMsg.RawDatas))})
+	}
+	if bucket, ok := r.msgType[agentMsg.Type]; ok {
+		costs = append(costs, cost{bucket, 1})
+	}
+
+	var wait time.Duration
+	for _, c := range costs {
+		c.bucket.refill(now)
+		if w := c.bucket.wait(c.n); w > wait {
+			wait = w
+		}
+	}
+	if wait == 0 || allow {
+		for _, c := range costs {
+			c.bucket.tokens -= c.n
+		}
+	}
+	return wait
+}
+
+// 对接收到的消息限流，返回false表示消息不应该被处理，只由读协程调用
+func (c *Client) throttle(agentMsg *msg.Msg) bool {
+	if c.rateLimiter == nil || rateLimitExempt[agentMsg.Type] {
+		return true
+	}
+
+	// delay策略下先消耗令牌再等待，令牌数为负时后续消息需要等待更久
+	wait := c.rateLimiter.reserve(agentMsg, time.Now(), c.rateLimiter.policy == RateLimitDelay)
+	if wait == 0 {
+		return true
+	}
+
+	switch c.rateLimiter.policy {
+	case RateLimitDelay:
+		atomic.AddUint64(&c.rateLimit.Delayed, 1)
+		atomic.AddInt64(&c.rateLimit.DelayMs, int64(wait/time.Millisecond))
+		log.Debugf("[IOServer] 客户端 %s 超过接收限制，消息类型 %d 延迟 %s 处理", c.clientId, agentMsg.Type, wait)
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return true
+		case <-c.closeCh:
+			return false
+		}
+	case RateLimitDisconnect:
+		atomic.AddUint64(&c.rateLimit.Dropped, 1)
+		log.Errorf("[IOServer] 客户端 %s 超过接收限制，消息类型 %d，断开连接", c.clientId, agentMsg.Type)
+		c.setState(Erroring)
+		c.Close()
+		return false
+	default:
+		atomic.AddUint64(&c.rateLimit.Dropped, 1)
+		log.Warnf("[IOServer] 客户端 %s 超过接收限制，丢弃消息, 消息类型 %d", c.clientId, agentMsg.Type)
+		return false
+	}
+}
+
+// 获取限流统计
+func (c *Client) GetRateLimitStats() RateLimitStats {
+	return RateLimitStats{
+		Dropped: atomic.LoadUint64(&c.rateLimit.Dropped),
+		Delayed: atomic.LoadUint64(&c.rateLimit.Delayed),
+		DelayMs: atomic.LoadInt64(&c.rateLimit.DelayMs),
+	}
+}
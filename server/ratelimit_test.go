@@ -0,0 +1,30 @@
+package server
+
+import (
+	"microserver/msg"
+	"testing"
+)
+
+// 超过限制时丢弃业务消息，协议控制报文不受影响
+func TestThrottleExemptsControlMsgs(t *testing.T) {
+	setTestConf(t, "[ratelimit]\nmsgrate = 1\nmsgburst = 1\nmsgrate.1 = 1\n")
+	client, _ := newTestClient(t, "agent-1")
+
+	if !client.throttle(&msg.Msg{Type: msg.CLIENT_MSG_COLLECT}) {
+		t.Fatal("第一条消息应该被处理")
+	}
+	if client.throttle(&msg.Msg{Type: msg.CLIENT_MSG_COLLECT}) {
+		t.Error("超过限制的业务消息应该被丢弃")
+	}
+	controlTypes := []uint64{msg.CLIENT_MSG_HEARTBEAT, msg.CLIENT_MSG_RPC_RESPONSE, msg.CLIENT_MSG_PONG, msg.CLIENT_MSG_OPERATION_ACK}
+	for _, msgType := range controlTypes {
+		for idx := 0; idx < 3; idx++ {
+			if !client.throttle(&msg.Msg{Type: msgType}) {
+				t.Errorf("协议控制报文 %d 不应该被限流", msgType)
+			}
+		}
+	}
+	if got := client.GetRateLimitStats().Dropped; got != 1 {
+		t.Errorf("丢弃的报文数为 %d，期望 1", got)
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	cfg "microserver/common/configparse"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"microserver/msg"
+	"sync/atomic"
+	"time"
+)
+
+// 默认的同步调用超时时间，单位秒
+const defaultCallTimeout = 30
+
+type rpcResult struct {
+	resp *msg.Msg
+	err  error
+}
+
+// 向客户端发起同步请求，并等待requestId相同的响应
+// ctx 没有设置超时时间时使用配置项 common.calltimeout
+func (s *IoServer) Call(ctx context.Context, clientId string, req *msg.Msg) (*msg.Msg, error) {
+	client, ok := s.getClient(clientId)
+	if !ok {
+		return nil, se.New(fmt.Sprintf("客户端 %s 不在线", clientId))
+	}
+
+	payload := []byte{}
+	if req.Msg != nil {
+		var err error
+		payload, err = proto.Marshal(req.Msg)
+		if err != nil {
+			log.Errorf("[IOServer] protobuf消息生成失败: %s", err.Error())
+			return nil, err
+		}
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := cfg.GlobalConf.GetInt("common", "calltimeout")
+		if timeout <= 0 {
+			timeout = defaultCallTimeout
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	requestId := atomic.AddUint64(&s.rpcSeq, 1)
+	resultCh := make(chan *rpcResult, 1)
+	if err := client.addPendingCall(requestId, resultCh); err != nil {
+		return nil, err
+	}
+	defer client.removePendingCall(requestId)
+
+	rpcMsg := &msg.Msg{
+		Type: msg.SERVER_MSG_RPC_REQUEST,
+		Msg: &msg.RpcRequest{
+			RequestId: requestId,
+			Type:      req.Type,
+			Payload:   payload,
+		},
+	}
+	log.Debugf("[IOServer] 向 %s 发起同步请求, requestId: %d, 消息类型: %d", clientId, requestId, req.Type)
+	if err := client.SendMsg(rpcMsg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case result := <-resultCh:
+		return result.resp, result.err
+	case <-ctx.Done():
+		log.Errorf("[IOServer] 等待 %s 的响应失败, requestId: %d, 原因: %s", clientId, requestId, ctx.Err().Error())
+		return nil, ctx.Err()
+	}
+}
+
+// 处理客户端返回的同步响应
+func (s *IoServer) handleClientRpcResponseMsg(client *Client, agentMsg *msg.Msg) {
+	rpcResp := agentMsg.Msg.(*msg.RpcResponse)
+	log.Debugf("[IOServer] 接收到 %s 的同步响应, requestId: %d, 消息类型: %d", client.clientId, rpcResp.RequestId, rpcResp.Type)
+
+	result := &rpcResult{}
+	if rpcResp.Error != "" {
+		result.err = se.New(fmt.Sprintf("客户端 %s 处理请求失败: %s", client.clientId, rpcResp.Error))
+	} else {
+		resp := &msg.Msg{
+			Type:     rpcResp.Type,
+			RawDatas: rpcResp.Payload,
+		}
+		// 响应类型如果注册过protobuf类型则一并解析
+		if entry, _ := s.msgHandlers.get(resp.Type); entry != nil {
+			if err := entry.decode(resp); err != nil {
+				log.Errorf("[IOServer] 解析 %s 的同步响应失败, requestId: %d, 失败原因 %s", client.clientId, rpcResp.RequestId, err.Error())
+				result.err = err
+			}
+		}
+		result.resp = resp
+	}
+
+	if !client.resolvePendingCall(rpcResp.RequestId, result) {
+		log.Warnf("[IOServer] %s 的同步响应没有对应的请求，可能已经超时, requestId: %d", client.clientId, rpcResp.RequestId)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	log "microserver/common/formatlog"
+	"microserver/msg"
+	"sync"
+)
+
+// 定向发送的结果
+const (
+	DeliverySent        = "sent"        // 已经写入连接
+	DeliveryOffline     = "offline"     // agent不在线
+	DeliveryWriteFailed = "writefailed" // 写入失败
+	DeliveryQueued      = "queued"      // 已经写入离线消息，agent重新连接后发送
+)
+
+type DeliveryResult struct {
+	AgentId  string `json:"agentid"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	OutboxId int64  `json:"outboxid,omitempty"` // 离线消息ID，状态为queued时有效
+}
+
+// 向指定agent发送消息并等待写入完成，agent存在多个连接时发送给最新的连接
+func (s *IoServer) SendToAgent(agentId string, agentMsg *msg.Msg) *DeliveryResult {
+	client, ok := s.getClient(agentId)
+	if !ok {
+		return &DeliveryResult{AgentId: agentId, Status: DeliveryOffline}
+	}
+	return s.sendToClient(client, agentMsg)
+}
+
+// 向一组agent发送消息，返回每个agent的发送结果，顺序与agentIds一致
+func (s *IoServer) SendToAgents(agentIds []string, agentMsg *msg.Msg) []*DeliveryResult {
+	results := make([]*DeliveryResult, len(agentIds))
+	wg := &sync.WaitGroup{}
+	for idx, agentId := range agentIds {
+		wg.Add(1)
+		go func(idx int, agentId string) {
+			defer wg.Done()
+			results[idx] = s.SendToAgent(agentId, agentMsg)
+		}(idx, agentId)
+	}
+	wg.Wait()
+	return results
+}
+
+// 向满足条件的在线agent发送消息，返回每个agent的发送结果
+func (s *IoServer) SendToSelection(selector func(client *Client) bool, agentMsg *msg.Msg) []*DeliveryResult {
+	selected := []*Client{}
+	for _, c := range s.agentClients() {
+		if selector(c) {
+			selected = append(selected, c)
+		}
+	}
+
+	results := make([]*DeliveryResult, len(selected))
+	wg := &sync.WaitGroup{}
+	for idx, c := range selected {
+		wg.Add(1)
+		go func(idx int, c *Client) {
+			defer wg.Done()
+			results[idx] = s.sendToClient(c, agentMsg)
+		}(idx, c)
+	}
+	wg.Wait()
+	return results
+}
+
+func (s *IoServer) sendToClient(client *Client, agentMsg *msg.Msg) *DeliveryResult {
+	if err := client.SendMsgWait(agentMsg); err != nil {
+		log.Errorf("[IOServer] 向 %s 发送消息失败, 消息类型 %d, 错误信息: %s", client.clientId, agentMsg.Type, err.Error())
+		return &DeliveryResult{AgentId: client.clientId, Status: DeliveryWriteFailed, Error: err.Error()}
+	}
+	return &DeliveryResult{AgentId: client.clientId, Status: DeliverySent}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	cfg "microserver/common/configparse"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"microserver/msg"
+	"sync/atomic"
+	"time"
+)
+
+/*
+每个客户端拥有一个有界的发送队列，由单独的写协程按顺序发送
+- common.sendqueuesize: 队列长度，默认256
+- common.sendqueuepolicy: 队列满时的处理策略
+  - block: 等待队列有空位(默认)，最长等待写超时，心跳响应和探测报文不等待
+  - drop: 丢弃当前消息
+  - disconnect: 断开客户端连接
+*/
+const (
+	SendQueueBlock      = "block"
+	SendQueueDrop       = "drop"
+	SendQueueDisconnect = "disconnect"
+)
+
+const defaultSendQueueSize = 256
+
+type sendItem struct {
+	msg  *msg.Msg
+	done chan error // 不为nil时写入完成后返回写入结果
+}
+
+// 发送队列统计
+type SendQueueStats struct {
+	Depth    int    `json:"depth"`    // 当前队列长度
+	Capacity int    `json:"capacity"` // 队列容量
+	MaxDepth uint64 `json:"maxdepth"` // 队列长度的历史最大值
+	Dropped  uint64 `json:"dropped"`  // 因为队列满被丢弃的消息数
+}
+
+func sendQueueSize() int {
+	size := cfg.GlobalConf.GetInt("common", "sendqueuesize")
+	if size <= 0 {
+		return defaultSendQueueSize
+	}
+	return size
+}
+
+func sendQueuePolicy() string {
+	policy := cfg.GlobalConf.GetStr("common", "sendqueuepolicy")
+	switch policy {
+	case SendQueueDrop, SendQueueDisconnect:
+		return policy
+	case "", SendQueueBlock:
+		return SendQueueBlock
+	default:
+		log.Warnf("[IOServer] 未知的发送队列策略 %s，使用默认策略 %s", policy, SendQueueBlock)
+		return SendQueueBlock
+	}
+}
+
+// 队列满时等待空位的上下文，最长等待写超时，未配置写超时时不限制
+func (c *Client) enqueueContext() (context.Context, context.CancelFunc) {
+	if c.writeTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(c.writeTimeout)*time.Second)
+}
+
+// 将消息放入发送队列，不等待写入结果
+func (c *Client) SendMsg(msg *msg.Msg) error {
+	ctx, cancel := c.enqueueContext()
+	defer cancel()
+	return c.enqueueCtx(ctx, &sendItem{msg: msg})
+}
+
+// 将消息放入发送队列，队列满时直接丢弃，不等待，用于心跳响应等可以丢弃的消息
+func (c *Client) trySendMsg(msg *msg.Msg) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return c.enqueueCtx(ctx, &sendItem{msg: msg})
+}
+
+// 将消息放入发送队列，并等待写入完成
+// 入队最长等待写超时，入队之后等待写入结果，写入本身受写超时限制
+func (c *Client) SendMsgWait(msg *msg.Msg) error {
+	ctx, cancel := c.enqueueContext()
+	defer cancel()
+	item := &sendItem{msg: msg, done: make(chan error, 1)}
+	if err := c.enqueueCtx(ctx, item); err != nil {
+		return err
+	}
+	return c.waitSent(context.Background(), item)
+}
+
+// 将消息放入发送队列，并等待写入完成，ctx 结束后不再等待
+func (c *Client) SendMsgCtx(ctx context.Context, msg *msg.Msg) error {
+	item := &sendItem{msg: msg, done: make(chan error, 1)}
+	if err := c.enqueueCtx(ctx, item); err != nil {
+		return err
+	}
+	return c.waitSent(ctx, item)
+}
+
+// 等待消息写入完成
+func (c *Client) waitSent(ctx context.Context, item *sendItem) error {
+	select {
+	case err := <-item.done:
+		return err
+	case <-c.closeCh:
+		return se.New(fmt.Sprintf("%s 连接已关闭，消息未发送", c.clientId))
+	case <-ctx.Done():
+		return se.New(fmt.Sprintf("%s 等待消息写入超时: %s", c.clientId, ctx.Err().Error()))
+	}
+}
+
+func (c *Client) enqueueCtx(ctx context.Context, item *sendItem) error {
+	if c.GetState() == Erroring {
+		log.Warnf("[IOServer] %s 无效，退出发消息循环", c.clientId)
+		return se.New(fmt.Sprintf("%s 无效，无法发送消息", c.clientId))
+	}
+
+	select {
+	case <-c.closeCh:
+		return se.New(fmt.Sprintf("%s 连接已关闭，无法发送消息", c.clientId))
+	case c.sendQueue <- item:
+		c.updateMaxQueueDepth()
+		return nil
+	default:
+	}
+
+	// 队列已满
+	switch c.sendQueuePolicy {
+	case SendQueueDrop:
+		atomic.AddUint64(&c.sendDropped, 1)
+		log.Warnf("[IOServer] %s 的发送队列已满，丢弃消息, 消息类型 %d", c.clientId, item.msg.Type)
+		return se.New(fmt.Sprintf("%s 的发送队列已满，消息被丢弃", c.clientId))
+	case SendQueueDisconnect:
+		atomic.AddUint64(&c.sendDropped, 1)
+		log.Errorf("[IOServer] %s 的发送队列已满，断开连接", c.clientId)
+		c.setState(Erroring)
+		c.Close()
+		return se.New(fmt.Sprintf("%s 的发送队列已满，连接被断开", c.clientId))
+	default:
+		select {
+		case <-c.closeCh:
+			return se.New(fmt.Sprintf("%s 连接已关闭，无法发送消息", c.clientId))
+		case c.sendQueue <- item:
+			c.updateMaxQueueDepth()
+			return nil
+		case <-ctx.Done():
+			atomic.AddUint64(&c.sendDropped, 1)
+			log.Warnf("[IOServer] %s 的发送队列已满，等待超时，丢弃消息, 消息类型 %d", c.clientId, item.msg.Type)
+			return se.New(fmt.Sprintf("%s 的发送队列已满，等待超时: %s", c.clientId, ctx.Err().Error()))
+		}
+	}
+}
+
+func (c *Client) updateMaxQueueDepth() {
+	depth := uint64(len(c.sendQueue))
+	for {
+		maxDepth := atomic.LoadUint64(&c.sendMaxDepth)
+		if depth <= maxDepth || atomic.CompareAndSwapUint64(&c.sendMaxDepth, maxDepth, depth) {
+			return
+		}
+	}
+}
+
+// 写协程，按入队顺序发送消息，连接关闭后退出
+func (c *Client) writeLoop() {
+	for {
+		select {
+		case <-c.closeCh:
+			return
+		case item := <-c.sendQueue:
+			err := c.writeMsg(item.msg)
+			if item.done != nil {
+				item.done <- err
+			}
+			// 写入失败后关闭连接，读协程会因此退出并清理客户端
+			if c.GetState() == Erroring {
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+// 关闭连接并停止写协程，可以重复调用
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closeCh)
+		c.conn.Close()
+	})
+}
+
+// 获取发送队列统计
+func (c *Client) GetSendQueueStats() SendQueueStats {
+	return SendQueueStats{
+		Depth:    len(c.sendQueue),
+		Capacity: cap(c.sendQueue),
+		MaxDepth: atomic.LoadUint64(&c.sendMaxDepth),
+		Dropped:  atomic.LoadUint64(&c.sendDropped),
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"microserver/msg"
+	"testing"
+	"time"
+)
+
+// agent不读取数据时，心跳响应不等待队列空位，其它消息最长等待写超时
+func TestSendQueueFullDoesNotBlock(t *testing.T) {
+	setTestConf(t, "sendqueuesize = 1\nsendqueuepolicy = block\nwriteimeout = 1\n")
+	client, _ := newTestClient(t, "agent-1")
+	heartbeat := &msg.Msg{Type: msg.SERVER_MSG_HEARTBEAT_RESPONSE}
+
+	// 写协程取走第一条消息后阻塞在写入上，第二条消息占满队列
+	client.SendMsg(heartbeat)
+	time.Sleep(50 * time.Millisecond)
+	client.SendMsg(heartbeat)
+
+	start := time.Now()
+	if err := client.trySendMsg(heartbeat); err == nil {
+		t.Error("队列满时 trySendMsg 应该返回错误")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("trySendMsg 耗时 %s，不应该等待", elapsed)
+	}
+	if got := client.GetSendQueueStats().Dropped; got != 1 {
+		t.Errorf("丢弃的消息数为 %d，期望 1", got)
+	}
+
+	start = time.Now()
+	if err := client.SendMsg(heartbeat); err == nil {
+		t.Error("队列一直满时 SendMsg 应该返回错误")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("SendMsg 耗时 %s，超过写超时", elapsed)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	cfg "microserver/common/configparse"
+	log "microserver/common/formatlog"
+	"microserver/msg"
+	"sync"
+)
+
+// 默认建议agent重连的间隔，单位秒
+const defaultReconnectHint = 10
+
+// 服务是否正在关闭
+func (s *IoServer) stopping() bool {
+	select {
+	case <-s.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// 登记一个待处理的消息，服务关闭后返回false
+func (s *IoServer) acquireMsg() bool {
+	s.dispatchLock.RLock()
+	defer s.dispatchLock.RUnlock()
+	if s.stopping() {
+		return false
+	}
+	s.msgWg.Add(1)
+	return true
+}
+
+// 优雅关闭IO服务
+// 停止接受新连接，通知agent服务端即将关闭，等待处理中的消息完成后关闭所有连接
+// ctx 超时后不再等待处理中的消息
+func (s *IoServer) Shutdown(ctx context.Context) error {
+	log.Infoln("[IOServer] IO服务开始关闭")
+	s.stopOnce.Do(func() {
+		// 持有写锁关闭，保证之后不会再有新的消息登记
+		s.dispatchLock.Lock()
+		close(s.stopCh)
+		s.dispatchLock.Unlock()
+	})
+
+	s.closeListeners()
+
+	// 通知agent服务端即将关闭，ctx 超时后不再等待
+	reconnectAfter := cfg.GlobalConf.GetInt("common", "reconnecthint")
+	if reconnectAfter <= 0 {
+		reconnectAfter = defaultReconnectHint
+	}
+	goAwayMsg := &msg.Msg{
+		Type: msg.SERVER_MSG_GOAWAY,
+		Msg: &msg.GoAway{
+			Reason:         "服务端关闭",
+			ReconnectAfter: int32(reconnectAfter),
+		},
+	}
+	clients := s.allClients()
+	sendWg := &sync.WaitGroup{}
+	for _, c := range clients {
+		sendWg.Add(1)
+		go func(c *Client) {
+			defer sendWg.Done()
+			c.SendMsgCtx(ctx, goAwayMsg)
+		}(c)
+	}
+	sendWg.Wait()
+	if ctx.Err() != nil {
+		log.Errorf("[IOServer] 通知客户端服务端关闭超时: %s", ctx.Err().Error())
+	} else {
+		log.Infof("[IOServer] 已通知 %d 个客户端服务端关闭, 建议 %d 秒后重连", len(clients), reconnectAfter)
+	}
+
+	// 等待处理中的消息
+	done := make(chan struct{})
+	go func() {
+		s.msgWg.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+		log.Infoln("[IOServer] 处理中的消息已经全部完成")
+	case <-ctx.Done():
+		err = ctx.Err()
+		log.Errorf("[IOServer] 等待处理中的消息超时: %s", err.Error())
+	}
+
+	for _, c := range clients {
+		c.setState(Erroring)
+		c.Close()
+	}
+	log.Infoln("[IOServer] IO服务关闭完成")
+	return err
+}
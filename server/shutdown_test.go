@@ -0,0 +1,31 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// agent不读取数据时，通知agent关闭的消息无法写入，Shutdown 在 ctx 超时后返回
+func TestShutdownGoAwayHonorsContext(t *testing.T) {
+	setTestConf(t, "")
+	s := newTestServer()
+	s.listenerLock = &sync.Mutex{}
+	s.stopOnce = &sync.Once{}
+	s.msgWg = &sync.WaitGroup{}
+	s.dispatchLock = &sync.RWMutex{}
+	client, _ := newTestClient(t, "agent1")
+	s.clients["agent1"] = []*Client{client}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	s.Shutdown(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown 耗时 %s，没有在 ctx 超时后返回", elapsed)
+	}
+	if !clientClosed(client) {
+		t.Errorf("Shutdown 之后客户端没有关闭")
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"microserver/common"
+	"sync/atomic"
+)
+
+// 连接统计，供HTTP接口展示
+type ConnectionStats struct {
+	AgentId         string             `json:"agentid"`
+	RemoteAddr      string             `json:"remoteaddr"`      // 对端地址
+	AgentIp         string             `json:"agentip"`         // agent当前的IP
+	State           int                `json:"state"`           // 客户端状态
+	ProtocolVersion uint32             `json:"protocolversion"` // 协商后的协议版本
+	ConnectedSince  string             `json:"connectedsince"`  // 建立连接的时间
+	LastMsgTime     string             `json:"lastmsgtime"`     // 服务端最近一次收到报文的时间
+	LastHeartbeat   string             `json:"lastheartbeat"`   // 服务端最近一次收到心跳的时间，没有收到过心跳时为空
+	AgentHeartbeat  string             `json:"agentheartbeat"`  // agent上报的最近一次心跳时间
+	BytesRecv       uint64             `json:"bytesrecv"`       // 接收的总的报文长度
+	BytesSent       uint64             `json:"bytessent"`       // 发送的总的报文长度
+	MsgsRecv        map[uint64]uint64  `json:"msgsrecv"`        // 按消息类型统计的接收消息数
+	MsgsSent        map[uint64]uint64  `json:"msgssent"`        // 按消息类型统计的发送消息数
+	SendQueue       SendQueueStats     `json:"sendqueue"`       // 发送队列统计
+	Ping            PingStats          `json:"ping"`            // 探测统计
+	Compression     CompressionStats   `json:"compression"`     // 压缩统计
+	Violations      ProtocolViolations `json:"violations"`      // 协议违规计数
+	RateLimit       RateLimitStats     `json:"ratelimit"`       // 限流统计
+}
+
+// 按消息类型计数
+func (c *Client) countMsg(counter map[uint64]uint64, msgType uint64) {
+	c.statsLock.Lock()
+	counter[msgType]++
+	c.statsLock.Unlock()
+}
+
+// 获取连接统计
+func (c *Client) GetConnectionStats() ConnectionStats {
+	stats := ConnectionStats{
+		AgentId:         c.clientId,
+		RemoteAddr:      c.conn.RemoteAddr().String(),
+		AgentIp:         c.agentIp,
+		State:           c.GetState(),
+		ProtocolVersion: c.GetProtocolVersion(),
+		ConnectedSince:  c.connectTime.Format(common.TIME_FORMAT),
+		LastMsgTime:     c.GetLastRecvTime().Format(common.TIME_FORMAT),
+		BytesRecv:       atomic.LoadUint64(&c.readTotalBytesLth),
+		BytesSent:       atomic.LoadUint64(&c.sentTotalBytesLth),
+		MsgsRecv:        map[uint64]uint64{},
+		MsgsSent:        map[uint64]uint64{},
+		SendQueue:       c.GetSendQueueStats(),
+		Ping:            c.GetPingStats(),
+		Compression:     c.GetCompressionStats(),
+		Violations:      c.GetProtocolViolations(),
+		RateLimit:       c.GetRateLimitStats(),
+	}
+
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+	stats.AgentHeartbeat = c.lastHeartbeatSyncTime
+	if !c.lastHeartbeatTime.IsZero() {
+		stats.LastHeartbeat = c.lastHeartbeatTime.Format(common.TIME_FORMAT)
+	}
+	for msgType, count := range c.recvMsgCount {
+		stats.MsgsRecv[msgType] = count
+	}
+	for msgType, count := range c.sentMsgCount {
+		stats.MsgsSent[msgType] = count
+	}
+	return stats
+}
+
+// 获取指定agent所有连接的统计，agent不在线时返回空列表
+func (s *IoServer) GetAgentConnections(agentId string) []ConnectionStats {
+	s.clientsLock.RLock()
+	sessions := append([]*Client{}, s.clients[agentId]...)
+	s.clientsLock.RUnlock()
+
+	result := []ConnectionStats{}
+	for _, c := range sessions {
+		result = append(result, c.GetConnectionStats())
+	}
+	return result
+}
+
+// 获取所有连接的统计
+func (s *IoServer) ListConnections() []ConnectionStats {
+	result := []ConnectionStats{}
+	for _, c := range s.allClients() {
+		result = append(result, c.GetConnectionStats())
+	}
+	return result
+}
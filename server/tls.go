@@ -0,0 +1,95 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	cfg "microserver/common/configparse"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"time"
+)
+
+/*
+	TLS配置, microserver.ini 中的 [tls] 段:
+	- enable: 是否开启TLS
+	- certfile / keyfile: 服务端证书和私钥
+	- clientcafile: 校验agent证书的CA，配置后agent提供的证书会被校验
+	- verifyclient: 是否强制要求agent提供证书(双向TLS)
+	监听可以在自己的配置段中覆盖 certfile、keyfile、clientcafile、verifyclient
+*/
+
+// 获取TLS配置，配置段中没有配置时使用 [tls] 中的配置
+func tlsConfValue(section string, key string) string {
+	if value := cfg.GlobalConf.GetStr(section, key); value != "" {
+		return value
+	}
+	return cfg.GlobalConf.GetStr("tls", key)
+}
+
+// 生成监听使用的TLS配置
+func newTlsConfig(section string) (*tls.Config, error) {
+	certFile := tlsConfValue(section, "certfile")
+	keyFile := tlsConfValue(section, "keyfile")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		log.Errorf("[IOServer] 加载TLS证书失败, cert: %s, key: %s, 错误信息: %s", certFile, keyFile, err.Error())
+		return nil, err
+	}
+
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		ClientAuth:   tls.NoClientCert,
+	}
+
+	clientCaFile := tlsConfValue(section, "clientcafile")
+	verifyClient := confBool(tlsConfValue(section, "verifyclient"))
+	if clientCaFile != "" {
+		caPem, err := ioutil.ReadFile(clientCaFile)
+		if err != nil {
+			log.Errorf("[IOServer] 读取客户端CA失败, ca: %s, 错误信息: %s", clientCaFile, err.Error())
+			return nil, err
+		}
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(caPem) {
+			return nil, se.New(fmt.Sprintf("客户端CA文件 %s 中没有有效的证书", clientCaFile))
+		}
+		tlsConf.ClientCAs = caPool
+		tlsConf.ClientAuth = tls.VerifyClientCertIfGiven
+		if verifyClient {
+			tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if verifyClient {
+		return nil, se.New("开启了客户端证书校验，但是没有配置 clientcafile")
+	}
+
+	return tlsConf, nil
+}
+
+// 完成TLS握手，如果agent提供了校验通过的证书则返回证书中的CN作为agent标识
+func (s *IoServer) getTlsConnId(conn *tls.Conn, timeout int) (string, error) {
+	conn.SetDeadline(time.Now().Add(time.Duration(timeout) * time.Second))
+	err := conn.Handshake()
+	conn.SetDeadline(time.Time{})
+	if err != nil {
+		log.Errorf("[IOServer] 与 %s 的TLS握手失败: %s", conn.RemoteAddr(), err.Error())
+		return "", err
+	}
+
+	return certIdFromState(conn.ConnectionState(), conn.RemoteAddr().String())
+}
+
+// 获取校验通过的证书中的CN，没有校验通过的证书时返回空
+func certIdFromState(state tls.ConnectionState, remoteAddr string) (string, error) {
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return "", nil
+	}
+	commonName := state.PeerCertificates[0].Subject.CommonName
+	if commonName == "" {
+		return "", se.New(fmt.Sprintf("对端 %s 的证书中没有CN信息", remoteAddr))
+	}
+	log.Debugf("[IOServer] 对端 %s 的证书校验通过，CN: %s", remoteAddr, commonName)
+	return commonName, nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+	cfg "microserver/common/configparse"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"sync/atomic"
+)
+
+// 默认的最大消息体长度，单位字节
+const defaultMaxPayloadSize = 4 * 1024 * 1024
+
+// 客户端的协议违规计数
+type ProtocolViolations struct {
+	OversizeFrames    uint64 `json:"oversizeframes"`    // 消息体超过最大长度的报文数
+	UnknownTypeFrames uint64 `json:"unknowntypeframes"` // 未知消息类型的报文数
+	UnknownFlagFrames uint64 `json:"unknownflagframes"` // 包含未知报文标记的报文数
+	MalformedPayloads uint64 `json:"malformedpayloads"` // 消息体无法解析的报文数
+}
+
+// 获取最大消息体长度，配置项 common.maxpayloadsize
+func maxPayloadSize() uint64 {
+	size := cfg.GlobalConf.GetInt("common", "maxpayloadsize")
+	if size <= 0 {
+		return defaultMaxPayloadSize
+	}
+	return uint64(size)
+}
+
+// 校验报文头，违规时返回错误，调用方负责断开连接
+func (c *Client) checkFrameHeader(payloadLth uint64, msgType uint64, flags uint32) error {
+	if payloadLth > c.maxPayloadSize {
+		atomic.AddUint64(&c.violations.OversizeFrames, 1)
+		log.Errorf("[IOServer] %s 的报文长度 %d 超过最大长度 %d，断开连接", c.clientId, payloadLth, c.maxPayloadSize)
+		return se.New(fmt.Sprintf("%s 的报文长度 %d 超过最大长度 %d", c.clientId, payloadLth, c.maxPayloadSize))
+	}
+	if c.knownMsgType != nil && !c.knownMsgType(msgType) {
+		atomic.AddUint64(&c.violations.UnknownTypeFrames, 1)
+		log.Errorf("[IOServer] %s 发送了未知的消息类型 %d，断开连接", c.clientId, msgType)
+		return se.New(fmt.Sprintf("%s 发送了未知的消息类型 %d", c.clientId, msgType))
+	}
+	if flags&^c.allowedFrameFlags() != 0 {
+		atomic.AddUint64(&c.violations.UnknownFlagFrames, 1)
+		log.Errorf("[IOServer] %s 发送了未知的报文标记 %#x，断开连接", c.clientId, flags)
+		return se.New(fmt.Sprintf("%s 发送了未知的报文标记 %#x", c.clientId, flags))
+	}
+	return nil
+}
+
+// 记录一次消息体解析失败
+func (c *Client) addMalformedPayload() {
+	atomic.AddUint64(&c.violations.MalformedPayloads, 1)
+}
+
+// 获取协议违规计数
+func (c *Client) GetProtocolViolations() ProtocolViolations {
+	return ProtocolViolations{
+		OversizeFrames:    atomic.LoadUint64(&c.violations.OversizeFrames),
+		UnknownTypeFrames: atomic.LoadUint64(&c.violations.UnknownTypeFrames),
+		UnknownFlagFrames: atomic.LoadUint64(&c.violations.UnknownFlagFrames),
+		MalformedPayloads: atomic.LoadUint64(&c.violations.MalformedPayloads),
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io"
+	"microserver/common"
+	cfg "microserver/common/configparse"
+	se "microserver/common/error"
+	log "microserver/common/formatlog"
+	"net"
+	"net/http"
+	"time"
+)
+
+/*
+WebSocket接入，供只能通过HTTP代理访问服务端的agent使用，microserver.ini 中的 [websocket]:
+- enable: 是否在HTTP服务上开启WebSocket接入
+- path: 接入路径，默认 /v1/ws/agent
+- allow / deny / maxconns / maxconnsperip: WebSocket接入额外的准入限制，[access] 中的全局限制同时生效
+- verifyclient: 是否要求agent提供校验通过的客户端证书，只读取 [websocket] 中的配置，[tls] 中的配置只对TCP监听生效
+  开启后HTTP服务需要以TLS方式提供并校验客户端证书，HTTP服务没有开启TLS时启动失败
+每个WebSocket二进制消息携带一段报文数据，报文格式与TCP接入完全一致，
+连接升级后按照TCP连接的流程认证和处理，对其它模块透明
+*/
+
+const (
+	defaultWebSocketPath = "/v1/ws/agent"
+	wsBufferLth          = 4096
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:   wsBufferLth,
+	WriteBufferSize:  wsBufferLth,
+	HandshakeTimeout: 10 * time.Second,
+}
+
+// 是否开启WebSocket接入
+func WebSocketEnabled() bool {
+	return cfg.GlobalConf.GetBool("websocket", "enable")
+}
+
+// 是否要求WebSocket接入提供客户端证书
+func webSocketVerifyClient() bool {
+	return cfg.GlobalConf.GetBool("websocket", "verifyclient")
+}
+
+// 检查WebSocket接入的配置，httpTls 表示HTTP服务是否以TLS方式提供
+func CheckWebSocketConf(httpTls bool) error {
+	if WebSocketEnabled() && webSocketVerifyClient() && !httpTls {
+		return se.New("[websocket] verifyclient 要求HTTP服务开启TLS，当前HTTP服务没有开启TLS")
+	}
+	return nil
+}
+
+// WebSocket接入路径
+func WebSocketPath() string {
+	path := cfg.GlobalConf.GetStr("websocket", "path")
+	if path == "" {
+		return defaultWebSocketPath
+	}
+	return path
+}
+
+// 将WebSocket连接适配为net.Conn，读写的数据与TCP连接上的字节流一致
+type wsConn struct {
+	ws     *websocket.Conn
+	reader io.Reader // 当前正在读取的消息
+	certId string    // HTTPS请求中校验通过的客户端证书的CN
+}
+
+func newWsConn(ws *websocket.Conn, certId string) *wsConn {
+	return &wsConn{ws: ws, certId: certId}
+}
+
+// 依次读取二进制消息中的数据，一个报文可以跨多个消息
+func (c *wsConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			msgType, r, err := c.ws.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			if msgType != websocket.BinaryMessage {
+				return 0, se.New(fmt.Sprintf("不支持的WebSocket消息类型 %d", msgType))
+			}
+			c.reader = r
+		}
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// 每次写入作为一个二进制消息发送，调用方需要保证写入不并发
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) Close() error {
+	return c.ws.Close()
+}
+
+func (c *wsConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *wsConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
+
+// 获取WebSocket请求的客户端证书身份，要求客户端证书时没有校验通过的证书返回错误
+func wsCertId(req *http.Request) (string, error) {
+	certId := ""
+	if req.TLS != nil {
+		var err error
+		certId, err = certIdFromState(*req.TLS, req.RemoteAddr)
+		if err != nil {
+			return "", err
+		}
+	}
+	if certId == "" && webSocketVerifyClient() {
+		return "", se.New(fmt.Sprintf("对端 %s 没有提供校验通过的客户端证书", req.RemoteAddr))
+	}
+	return certId, nil
+}
+
+// 处理WebSocket接入请求，升级完成后与TCP连接共用同一套处理流程
+// 准入检查和证书校验在升级之前完成，被拒绝的请求返回403
+func (s *IoServer) ServeWebSocket(res http.ResponseWriter, req *http.Request) {
+	if s.stopping() {
+		http.Error(res, "服务正在关闭", http.StatusServiceUnavailable)
+		return
+	}
+
+	agentIp, err := common.HostIpFromAddr(req.RemoteAddr)
+	if err != nil {
+		log.Errorf("[IOServer] WebSocket对端地址信息异常: %s", req.RemoteAddr)
+		http.Error(res, "对端地址信息异常", http.StatusBadRequest)
+		return
+	}
+	certId, err := wsCertId(req)
+	if err != nil {
+		log.Errorf("[IOServer] 拒绝WebSocket接入: %s", err.Error())
+		http.Error(res, "客户端证书校验失败", http.StatusForbidden)
+		return
+	}
+	if !s.admitConn(s.access, req.RemoteAddr, agentIp) {
+		http.Error(res, "拒绝访问", http.StatusForbidden)
+		return
+	}
+	defer s.releaseConn(s.access, agentIp)
+
+	ws, err := wsUpgrader.Upgrade(res, req, nil)
+	if err != nil {
+		// Upgrade 失败时已经向对端返回了错误响应
+		log.Errorf("[IOServer] %s 的WebSocket升级失败: %s", req.RemoteAddr, err.Error())
+		return
+	}
+	conn := newWsConn(ws, certId)
+	log.Debugf("[IOServer] IO服务收到WebSocket连接请求，对端 -> 本端信息: %s -> %s", conn.RemoteAddr(), conn.LocalAddr())
+	s.handleConnection(conn, agentIp)
+}
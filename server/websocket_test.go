@@ -0,0 +1,71 @@
+package server
+
+import (
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 发起WebSocket握手，返回HTTP状态码
+func wsDialStatus(t *testing.T, s *IoServer) int {
+	srv := httptest.NewServer(http.HandlerFunc(s.ServeWebSocket))
+	defer srv.Close()
+
+	ws, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err == nil {
+		ws.Close()
+	}
+	if resp == nil {
+		t.Fatalf("WebSocket握手没有响应: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestServeWebSocketDenied(t *testing.T) {
+	setTestConf(t, "[access]\ndeny = 127.0.0.1\n")
+	s := newTestServer()
+	s.globalAccess = newTestAccess(t, "access")
+	s.access = newTestAccess(t, "websocket")
+
+	if status := wsDialStatus(t, s); status != http.StatusForbidden {
+		t.Errorf("被拒绝的IP握手返回 %d，期望 %d", status, http.StatusForbidden)
+	}
+	if got := s.globalAccess.getStats(); got.DeniedConns != 1 || got.Connections != 0 {
+		t.Errorf("准入统计为 %+v，期望拒绝1个连接且没有登记的连接", got)
+	}
+}
+
+func TestServeWebSocketRequireClientCert(t *testing.T) {
+	setTestConf(t, "[websocket]\nverifyclient = true\n")
+	s := newTestServer()
+	s.globalAccess = newTestAccess(t, "access")
+	s.access = newTestAccess(t, "websocket")
+
+	if status := wsDialStatus(t, s); status != http.StatusForbidden {
+		t.Errorf("要求客户端证书时没有证书的握手返回 %d，期望 %d", status, http.StatusForbidden)
+	}
+	if got := s.globalAccess.getStats().Connections; got != 0 {
+		t.Errorf("被拒绝的握手不应该登记连接，当前连接数 %d", got)
+	}
+}
+
+// [tls] 中的 verifyclient 只对TCP监听生效，不影响WebSocket接入
+func TestServeWebSocketIgnoresTlsVerifyClient(t *testing.T) {
+	setTestConf(t, "[tls]\nverifyclient = true\n")
+	req := httptest.NewRequest("GET", WebSocketPath(), nil)
+	if certId, err := wsCertId(req); err != nil || certId != "" {
+		t.Errorf("[tls] verifyclient 开启时 wsCertId 返回 (%q, %v)，期望没有错误", certId, err)
+	}
+}
+
+func TestCheckWebSocketConf(t *testing.T) {
+	setTestConf(t, "[websocket]\nenable = true\nverifyclient = true\n")
+	if err := CheckWebSocketConf(false); err == nil {
+		t.Error("HTTP服务没有开启TLS时要求客户端证书应该返回错误")
+	}
+	if err := CheckWebSocketConf(true); err != nil {
+		t.Errorf("HTTP服务开启TLS时返回错误: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	cfg "microserver/common/configparse"
+	log "microserver/common/formatlog"
+	"microserver/msg"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	消息处理协程池
+	- common.workernum: 处理协程数，默认为CPU数的4倍
+	- common.workerqueuesize: 每个客户端的待处理消息队列长度，默认128
+	每个客户端拥有独立的待处理队列，同一时间只会被一个处理协程处理，保证按接收顺序处理
+	处理协程每次从一个客户端取一条消息，处理完成后客户端重新排队，一个客户端的处理阻塞不会影响其它客户端的队列
+	客户端的队列满时读协程会阻塞，不再从该连接读取新的报文
+	同步请求的响应和探测响应由读协程直接处理，不经过协程池，避免排在等待响应的处理之后
+*/
+
+const defaultWorkerQueueSize = 128
+
+// 由读协程直接处理的消息类型
+var inlineMsgTypes = map[uint64]bool{
+	msg.CLIENT_MSG_RPC_RESPONSE: true,
+	msg.CLIENT_MSG_PONG:         true,
+}
+
+func workerQueueSize() int {
+	size := cfg.GlobalConf.GetInt("common", "workerqueuesize")
+	if size <= 0 {
+		return defaultWorkerQueueSize
+	}
+	return size
+}
+
+type workerPool struct {
+	lock   *sync.Mutex
+	cond   *sync.Cond
+	ready  []*Client // 有待处理消息的客户端，每个客户端最多出现一次
+	handle func(agentMsg *msg.Msg, client *Client)
+}
+
+func newWorkerPool(handle func(agentMsg *msg.Msg, client *Client)) *workerPool {
+	workerNum := cfg.GlobalConf.GetInt("common", "workernum")
+	if workerNum <= 0 {
+		workerNum = runtime.NumCPU() * 4
+	}
+
+	p := &workerPool{
+		lock:   &sync.Mutex{},
+		ready:  []*Client{},
+		handle: handle,
+	}
+	p.cond = sync.NewCond(p.lock)
+	for idx := 0; idx < workerNum; idx++ {
+		go p.work()
+	}
+	log.Infof("[IOServer] 消息处理协程池启动, 协程数: %d, 客户端队列长度: %d", workerNum, workerQueueSize())
+	return p
+}
+
+// 客户端排队等待处理
+func (p *workerPool) schedule(client *Client) {
+	p.lock.Lock()
+	p.ready = append(p.ready, client)
+	p.lock.Unlock()
+	p.cond.Signal()
+}
+
+func (p *workerPool) work() {
+	for {
+		p.lock.Lock()
+		for len(p.ready) == 0 {
+			p.cond.Wait()
+		}
+		client := p.ready[0]
+		p.ready[0] = nil
+		p.ready = p.ready[1:]
+		p.lock.Unlock()
+
+		select {
+		case agentMsg := <-client.mailbox:
+			p.handle(agentMsg, client)
+		default:
+		}
+
+		// 释放客户端，还有待处理的消息时重新排队
+		atomic.StoreInt32(&client.mailboxScheduled, 0)
+		if len(client.mailbox) > 0 && atomic.CompareAndSwapInt32(&client.mailboxScheduled, 0, 1) {
+			p.schedule(client)
+		}
+	}
+}
+
+// 提交消息到客户端的待处理队列，队列满时阻塞
+func (p *workerPool) submit(agentMsg *msg.Msg, client *Client) {
+	client.mailbox <- agentMsg
+	if atomic.CompareAndSwapInt32(&client.mailboxScheduled, 0, 1) {
+		p.schedule(client)
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"microserver/msg"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 一个客户端的处理阻塞时，其它客户端的消息仍然可以处理，同一个客户端的消息按顺序处理
+func TestWorkerPoolIsolatesClients(t *testing.T) {
+	setTestConf(t, "workernum = 2\n")
+	release := make(chan struct{})
+	handledB := make(chan struct{})
+	lock := &sync.Mutex{}
+	order := []uint64{}
+	pool := newWorkerPool(func(agentMsg *msg.Msg, client *Client) {
+		if client.clientId == "b" {
+			close(handledB)
+			return
+		}
+		if agentMsg.Type == 1 {
+			<-release
+		}
+		lock.Lock()
+		order = append(order, agentMsg.Type)
+		lock.Unlock()
+	})
+
+	a, _ := newTestClient(t, "a")
+	b, _ := newTestClient(t, "b")
+	for idx := uint64(1); idx <= 3; idx++ {
+		pool.submit(&msg.Msg{Type: idx}, a)
+	}
+	pool.submit(&msg.Msg{Type: 1}, b)
+
+	select {
+	case <-handledB:
+	case <-time.After(time.Second):
+		t.Fatal("客户端 a 的处理阻塞了客户端 b 的消息")
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		lock.Lock()
+		n := len(order)
+		lock.Unlock()
+		if n == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 3 {
+		t.Errorf("客户端 a 的消息处理顺序为 %v，期望 [1 2 3]", order)
+	}
+}
@@ -1,11 +1,40 @@
 package structs
 
 type Agent struct {
-	Id      int64  `json:"id"`
-	AgentIp string `json:"agentip"`
+	Id       int64  `json:"id"`
+	AgentId  string `json:"agentid"`
+	AgentIp  string `json:"agentip"`
+	IpFamily string `json:"ipfamily"` // ipv4 或 ipv6
 }
 
 type Version struct {
-	AgentVersion      string  `json:"version"`
-	UpdateTime string `json:"updatetime"`
-}
\ No newline at end of file
+	AgentVersion string `json:"version"`
+	UpdateTime   string `json:"updatetime"`
+}
+
+// 离线消息，agent重新连接后按Id顺序发送
+type OutboxItem struct {
+	Id         int64  `json:"id"`
+	AgentId    string `json:"agentid"`
+	MsgType    uint64 `json:"msgtype"`
+	Payload    []byte `json:"-"`
+	CreateTime string `json:"createtime"`
+	ExpireTime string `json:"expiretime"`
+}
+
+// 可追踪的广播操作
+type Operation struct {
+	OperationId string `json:"operationid"`
+	OpType      string `json:"type"`
+	CreateTime  string `json:"createtime"`
+}
+
+// agent在操作中的状态，Final为true表示agent回复了执行结果
+type OperationAgent struct {
+	OperationId string `json:"operationid"`
+	AgentId     string `json:"agentid"`
+	Status      string `json:"status"`
+	Error       string `json:"error"`
+	Final       bool   `json:"final"`
+	UpdateTime  string `json:"updatetime"`
+}